@@ -0,0 +1,389 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/mailer"
+	"github.com/N0tR1CH/sad/internal/services"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// dataExportCooldown is the time the user waits
+	// before the next export can be requested.
+	dataExportCooldown = time.Hour
+	dataExportLifetime = 7 * 24 * time.Hour
+	// dataExportTimeout is the time after which pending export is
+	// considered lost, it is generated in the background and does
+	// not survive restart of the server.
+	dataExportTimeout = 10 * time.Minute
+	// accountDeletionGracePeriod is the time the user
+	// has to change their mind about deleting the account.
+	accountDeletionGracePeriod = 14 * 24 * time.Hour
+	// accountDataSweepInterval is how often expired exports
+	// and accounts due for deletion are removed.
+	accountDataSweepInterval = time.Hour
+	accountDataDateLayout    = "2006-01-02 15:04 MST"
+)
+
+// startAccountDataWorker launches worker failing lost and removing
+// expired exports and deleting accounts whose grace period is over. It stops once ctx is
+// done and is tracked by the wait group like the preview workers.
+func (app *application) startAccountDataWorker(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		for {
+			app.sweepAccountData()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(accountDataSweepInterval):
+			}
+		}
+	}()
+	app.logger.Info("account data worker started")
+}
+
+func (app *application) sweepAccountData() {
+	if n, err := app.models.DataExports.FailStale(dataExportTimeout); err != nil {
+		app.logger.Error("app#sweepAccountData", "err", err.Error())
+	} else if n > 0 {
+		app.logger.Warn("lost data exports failed", "count", n)
+	}
+	if n, err := app.models.DataExports.DeleteExpired(); err != nil {
+		app.logger.Error("app#sweepAccountData", "err", err.Error())
+	} else if n > 0 {
+		app.logger.Info("expired data exports removed", "count", n)
+	}
+
+	ids, err := app.models.Accounts.DueForDeletion()
+	if err != nil {
+		app.logger.Error("app#sweepAccountData", "err", err.Error())
+		return
+	}
+	for _, id := range ids {
+		if err := app.deleteAccount(id); err != nil {
+			app.logger.Error("app#sweepAccountData", "userID", id, "err", err.Error())
+		}
+	}
+}
+
+// deleteAccount removes the user whose deletion is due, together
+// with their sessions and avatar.
+func (app *application) deleteAccount(userID int) error {
+	avatarSrc, err := app.models.Accounts.Delete(userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			// Deletion was cancelled in the meantime
+			return nil
+		}
+		return fmt.Errorf("in app#deleteAccount: %w", err)
+	}
+	app.logger.Info("account deleted", "userID", userID)
+	if err := app.destroyUserSessions(userID); err != nil {
+		return fmt.Errorf("in app#deleteAccount: %w", err)
+	}
+	if avatarSrc != "" {
+		if err := app.services.Avatars.Remove(avatarSrc); err != nil {
+			return fmt.Errorf("in app#deleteAccount: %w", err)
+		}
+	}
+	return nil
+}
+
+// buildDataExport packs personal data of the user into zip archive
+// with data.json and the avatar, if the user has one.
+func (app *application) buildDataExport(userID int) ([]byte, error) {
+	pd, err := app.models.Accounts.PersonalData(userID)
+	if err != nil {
+		return nil, fmt.Errorf("in app#buildDataExport: %w", err)
+	}
+	js, err := json.MarshalIndent(pd, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("in app#buildDataExport: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("data.json")
+	if err != nil {
+		return nil, fmt.Errorf("in app#buildDataExport: %w", err)
+	}
+	if _, err := w.Write(js); err != nil {
+		return nil, fmt.Errorf("in app#buildDataExport: %w", err)
+	}
+	if src := pd.Profile.AvatarSrc; src != "" {
+		avatar, err := app.services.Avatars.Read(src)
+		switch {
+		case errors.Is(err, services.ErrAvatarNotStored):
+			// Url of the avatar is in data.json already
+		case err != nil:
+			return nil, fmt.Errorf("in app#buildDataExport: %w", err)
+		default:
+			w, err := zw.Create("avatar" + path.Ext(src))
+			if err != nil {
+				return nil, fmt.Errorf("in app#buildDataExport: %w", err)
+			}
+			if _, err := w.Write(avatar); err != nil {
+				return nil, fmt.Errorf("in app#buildDataExport: %w", err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("in app#buildDataExport: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (app *application) generateDataExport(exportID, userID int) {
+	archive, err := app.buildDataExport(userID)
+	if err != nil {
+		app.logger.Error("app#generateDataExport", "exportID", exportID, "err", err.Error())
+		if err := app.models.DataExports.Fail(exportID); err != nil {
+			app.logger.Error("app#generateDataExport", "exportID", exportID, "err", err.Error())
+		}
+		return
+	}
+	if err := app.models.DataExports.Complete(exportID, archive); err != nil {
+		app.logger.Error("app#generateDataExport", "exportID", exportID, "err", err.Error())
+	}
+}
+
+// formatSize describes number of bytes for humans.
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+func newDataExportViewModel(e *data.DataExport) pages.DataExportViewModel {
+	if e == nil {
+		return pages.DataExportViewModel{}
+	}
+	status := e.Status
+	if status == data.DataExportPending && time.Since(e.CreatedAt) > dataExportTimeout {
+		// Worker has not failed it yet
+		status = data.DataExportFailed
+	}
+	return pages.DataExportViewModel{
+		Id:        e.ID,
+		Status:    string(status),
+		CreatedAt: e.CreatedAt.UTC().Format(accountDataDateLayout),
+		ExpiresAt: e.ExpiresAt.UTC().Format(accountDataDateLayout),
+		Size:      formatSize(e.Size),
+	}
+}
+
+// latestDataExport returns nil when the user has no export.
+func (app *application) latestDataExport(userID int) (*data.DataExport, error) {
+	e, err := app.models.DataExports.Latest(userID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (app *application) accountDeletionViewModel(userID int) (pages.AccountDeletionViewModel, error) {
+	isAdmin, err := app.models.Users.HasRole(userID, "admin")
+	if err != nil {
+		return pages.AccountDeletionViewModel{}, err
+	}
+	at, err := app.models.Accounts.DeletionScheduledAt(userID)
+	if err != nil {
+		return pages.AccountDeletionViewModel{}, err
+	}
+	vm := pages.AccountDeletionViewModel{CanDelete: !isAdmin}
+	if !at.IsZero() {
+		vm.ScheduledAt = at.UTC().Format(accountDataDateLayout)
+	}
+	return vm, nil
+}
+
+// Personal data can only be exported or deleted from the browser
+// session, the same as sessions and personal access tokens.
+func (app *application) getAccountDataHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	uID := c.Get("userID").(int)
+	e, err := app.latestDataExport(uID)
+	if err != nil {
+		return fmt.Errorf("in app#getAccountDataHandler: %w", err)
+	}
+	deletion, err := app.accountDeletionViewModel(uID)
+	if err != nil {
+		return fmt.Errorf("in app#getAccountDataHandler: %w", err)
+	}
+	return views.Render(c, http.StatusOK, pages.AccountDataPage(pages.AccountDataViewModel{
+		Export:   newDataExportViewModel(e),
+		Deletion: deletion,
+	}))
+}
+
+// requestDataExportHandler queues generation of the archive,
+// the page polls for it until it is ready.
+func (app *application) requestDataExportHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	uID := c.Get("userID").(int)
+	e, err := app.latestDataExport(uID)
+	if err != nil {
+		return fmt.Errorf("in app#requestDataExportHandler: %w", err)
+	}
+	// Pending exports are failed by the worker after the timeout,
+	// which is shorter than the cooldown
+	if e != nil && time.Since(e.CreatedAt) < dataExportCooldown {
+		vm := newDataExportViewModel(e)
+		vm.Msg = "You can request one archive per hour."
+		return views.Render(c, http.StatusOK, pages.DataExport(vm))
+	}
+
+	e = &data.DataExport{
+		UserID:    uID,
+		ExpiresAt: time.Now().Add(dataExportLifetime),
+	}
+	if err := app.models.DataExports.Insert(e); err != nil {
+		return fmt.Errorf("in app#requestDataExportHandler: %w", err)
+	}
+	exportID := e.ID
+	app.startBackgroundJob(func() {
+		app.generateDataExport(exportID, uID)
+	})
+	return views.Render(c, http.StatusOK, pages.DataExport(newDataExportViewModel(e)))
+}
+
+func (app *application) downloadDataExportHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	var input struct {
+		ID string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	exportID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	archive, err := app.models.DataExports.Archive(c.Get("userID").(int), exportID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return fmt.Errorf("in app#downloadDataExportHandler: %w", err)
+	}
+	h := c.Response().Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set(
+		echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="sad-data-%d.zip"`, exportID),
+	)
+	return c.Blob(http.StatusOK, "application/zip", archive)
+}
+
+// scheduleAccountDeletionHandler asks for the password, the account
+// is deleted by the worker once the grace period is over.
+func (app *application) scheduleAccountDeletionHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	var input struct {
+		Password string `form:"password" validate:"required,max=64"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	uID := c.Get("userID").(int)
+	vm, err := app.accountDeletionViewModel(uID)
+	if err != nil {
+		return fmt.Errorf("in app#scheduleAccountDeletionHandler: %w", err)
+	}
+	if !vm.CanDelete || vm.ScheduledAt != "" {
+		return views.Render(c, http.StatusOK, pages.AccountDeletion(vm))
+	}
+	if err := c.Validate(&input); err != nil {
+		vm.ErrMsg = "Provide your current password."
+		return views.Render(c, http.StatusOK, pages.AccountDeletion(vm))
+	}
+
+	email, err := app.models.Users.GetEmail(uID)
+	if err != nil {
+		return fmt.Errorf("in app#scheduleAccountDeletionHandler: %w", err)
+	}
+	u, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		return fmt.Errorf("in app#scheduleAccountDeletionHandler: %w", err)
+	}
+	match, err := u.Password.Match(input.Password)
+	if err != nil {
+		return fmt.Errorf("in app#scheduleAccountDeletionHandler: %w", err)
+	}
+	if !match {
+		vm.ErrMsg = "Password is not right."
+		return views.Render(c, http.StatusOK, pages.AccountDeletion(vm))
+	}
+
+	deleteAt := time.Now().Add(accountDeletionGracePeriod)
+	if err := app.models.Accounts.ScheduleDeletion(uID, deleteAt); err != nil &&
+		!errors.Is(err, data.ErrEditConflict) {
+		return fmt.Errorf("in app#scheduleAccountDeletionHandler: %w", err)
+	}
+	if vm, err = app.accountDeletionViewModel(uID); err != nil {
+		return fmt.Errorf("in app#scheduleAccountDeletionHandler: %w", err)
+	}
+
+	scheduledAt := vm.ScheduledAt
+	app.startBackgroundJob(func() {
+		if err := app.mailer.Send(
+			u.Email,
+			mailer.AccountDeletionScheduledSubject(),
+			mailer.AccountDeletionScheduledPlainBody(scheduledAt),
+			mailer.AccountDeletionScheduledHtmlBody(scheduledAt),
+		); err != nil {
+			app.logger.Error(
+				"app#scheduleAccountDeletionHandler while sending email",
+				"err", err.Error(),
+			)
+		}
+	})
+	return views.Render(c, http.StatusOK, pages.AccountDeletion(vm))
+}
+
+func (app *application) cancelAccountDeletionHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	uID := c.Get("userID").(int)
+	if err := app.models.Accounts.CancelDeletion(uID); err != nil &&
+		!errors.Is(err, data.ErrRecordNotFound) {
+		return fmt.Errorf("in app#cancelAccountDeletionHandler: %w", err)
+	}
+	vm, err := app.accountDeletionViewModel(uID)
+	if err != nil {
+		return fmt.Errorf("in app#cancelAccountDeletionHandler: %w", err)
+	}
+	return views.Render(c, http.StatusOK, pages.AccountDeletion(vm))
+}
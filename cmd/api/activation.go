@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/mailer"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/labstack/echo/v4"
+)
+
+// activationResendCooldown is the minimum time between
+// two activation emails sent to the same user.
+const activationResendCooldown = 5 * time.Minute
+
+// sendActivationEmail generates new activation token
+// and mails the link to the user in the background.
+func (app *application) sendActivationEmail(u *data.User) error {
+	t, err := app.models.Tokens.New(
+		u.ID,
+		24*time.Hour,
+		data.TokenType(data.TokenTypeActivation),
+	)
+	if err != nil {
+		return fmt.Errorf("in app#sendActivationEmail: %w", err)
+	}
+	app.startBackgroundJob(func() {
+		if err := app.mailer.Send(
+			u.Email,
+			mailer.MailSubject(),
+			mailer.PlainBody(u.ID, t.PlainText),
+			mailer.HtmlBody(u.ID, t.PlainText),
+		); err != nil {
+			app.logger.Error(
+				"app#sendActivationEmail while sending email",
+				"Err", err.Error(),
+			)
+		}
+	})
+	return nil
+}
+
+// resendActivationHandler sends new activation link to the logged in
+// user. Previous links stop working once the new one is sent.
+func (app *application) resendActivationHandler(c echo.Context) error {
+	uID := c.Get("userID").(int)
+	email, err := app.models.Users.GetEmail(uID)
+	if err != nil {
+		return fmt.Errorf("in app#resendActivationHandler: %w", err)
+	}
+	u, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		return fmt.Errorf("in app#resendActivationHandler: %w", err)
+	}
+	if u.Activated {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ResendActivationResult("Your account is already activated.", true),
+		)
+	}
+
+	lastSentAt, err := app.models.Tokens.LastCreatedAt(data.TokenTypeActivation, u.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return fmt.Errorf("in app#resendActivationHandler: %w", err)
+	}
+	if wait := time.Until(lastSentAt.Add(activationResendCooldown)); err == nil && wait > 0 {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ResendActivationResult(
+				fmt.Sprintf(
+					"Email was sent recently, try again in %d minute(s).",
+					int(math.Ceil(wait.Minutes())),
+				),
+				false,
+			),
+		)
+	}
+
+	if err := app.models.Tokens.DeleteAllForUser(data.TokenTypeActivation, u.ID); err != nil {
+		return fmt.Errorf("in app#resendActivationHandler: %w", err)
+	}
+	if err := app.sendActivationEmail(u); err != nil {
+		return fmt.Errorf("in app#resendActivationHandler: %w", err)
+	}
+	return views.Render(
+		c,
+		http.StatusOK,
+		pages.ResendActivationResult(
+			fmt.Sprintf("We have sent new activation link to %s.", u.Email),
+			true,
+		),
+	)
+}
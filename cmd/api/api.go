@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/N0tR1CH/sad/internal/markdown"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// Every response of the JSON API is wrapped in the envelope, so clients
+// can tell data from errors without looking at the status code.
+//
+//	{"data": ..., "meta": {...}}
+//	{"error": {"code": "not_found", "message": "...", "fields": {...}}}
+type apiEnvelope struct {
+	Data  any           `json:"data,omitempty"`
+	Meta  any           `json:"meta,omitempty"`
+	Error *apiErrorBody `json:"error,omitempty"`
+}
+
+type apiErrorBody struct {
+	// Code is the snake cased status text, e.g. unprocessable_entity.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields maps names of invalid input fields to their problems.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// apiPageMeta describes page of the list paginated with page numbers.
+type apiPageMeta struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+func newAPIPageMeta(page, perPage, total int) apiPageMeta {
+	return apiPageMeta{
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: (total + perPage - 1) / perPage,
+	}
+}
+
+// apiCursorMeta describes page of the list paginated with cursor,
+// NextCursor is null on the last page.
+type apiCursorMeta struct {
+	Limit      int  `json:"limit"`
+	NextCursor *int `json:"next_cursor"`
+}
+
+// apiIDInput identifies the resource in the path.
+type apiIDInput struct {
+	ID string `param:"id" json:"-" validate:"required,number"`
+}
+
+// apiIDPageInput selects page of the list belonging to the resource.
+type apiIDPageInput struct {
+	ID   string `param:"id" json:"-" validate:"required,number"`
+	Page int    `query:"page" validate:"omitempty,min=1"`
+}
+
+// isAPIRequest reports whether the request targets the JSON API,
+// middleware answers such requests with JSON instead of redirects.
+func isAPIRequest(c echo.Context) bool {
+	return strings.HasPrefix(c.Request().URL.Path, "/api/")
+}
+
+func apiData(c echo.Context, status int, data any, meta any) error {
+	return c.JSON(status, apiEnvelope{Data: data, Meta: meta})
+}
+
+func apiErrorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+func apiError(c echo.Context, status int, message string) error {
+	return c.JSON(status, apiEnvelope{
+		Error: &apiErrorBody{Code: apiErrorCode(status), Message: message},
+	})
+}
+
+func apiFieldsError(c echo.Context, fields map[string]string) error {
+	status := http.StatusUnprocessableEntity
+	return c.JSON(status, apiEnvelope{
+		Error: &apiErrorBody{
+			Code:    apiErrorCode(status),
+			Message: "Input is invalid.",
+			Fields:  fields,
+		},
+	})
+}
+
+// apiValidationError responds with problems of the input
+// reported by the validator.
+func apiValidationError(c echo.Context, input any, err error) error {
+	var ves validator.ValidationErrors
+	if !errors.As(err, &ves) {
+		return apiError(c, http.StatusBadRequest, err.Error())
+	}
+	t := reflect.Indirect(reflect.ValueOf(input)).Type()
+	fields := make(map[string]string, len(ves))
+	for _, ve := range ves {
+		name := ve.Field()
+		if f, ok := t.FieldByName(ve.StructField()); ok {
+			name = apiFieldName(f)
+		}
+		fields[name] = apiValidationMsg(ve)
+	}
+	return apiFieldsError(c, fields)
+}
+
+// apiFieldName returns name under which clients send the field.
+func apiFieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "query", "param"} {
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func apiValidationMsg(ve validator.FieldError) string {
+	unit := ""
+	if ve.Kind() == reflect.String {
+		unit = " characters"
+	}
+	switch ve.Tag() {
+	case "required":
+		return "is required"
+	case "number":
+		return "must be a number"
+	case "url":
+		return "must be a valid URL"
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", ve.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", ve.Param(), unit)
+	case "markdown":
+		return fmt.Sprintf("must be at most %d characters", markdown.MaxLength)
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", ve.Param())
+	default:
+		return fmt.Sprintf("does not satisfy %s", ve.Tag())
+	}
+}
+
+// httpErrorHandler wraps errors returned from the JSON API in the
+// envelope. Details of internal errors are only logged, other
+// requests are handled by the default echo handler.
+func (app *application) httpErrorHandler(e *echo.Echo) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if !isAPIRequest(c) || c.Response().Committed {
+			e.DefaultHTTPErrorHandler(err, c)
+			return
+		}
+		status := http.StatusInternalServerError
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			status = he.Code
+		}
+		message := http.StatusText(status)
+		if he != nil && status < http.StatusInternalServerError {
+			if msg, ok := he.Message.(string); ok {
+				message = msg
+			}
+		}
+		if err := apiError(c, status, message); err != nil {
+			app.logger.Error("app#httpErrorHandler", "err", err.Error())
+		}
+	}
+}
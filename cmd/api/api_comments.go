@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type apiAuthor struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	AvatarUrl string `json:"avatar_url"`
+}
+
+type apiComment struct {
+	ID           int       `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	DiscussionID int       `json:"discussion_id"`
+	// ParentID is null for top level comments.
+	ParentID *int `json:"parent_id"`
+	// EditedAt is null unless the content was edited.
+	EditedAt *time.Time `json:"edited_at"`
+	// Deleted comment has no content nor author, it is kept
+	// so its replies stay in the tree.
+	Deleted      bool   `json:"deleted"`
+	Content      string `json:"content"`
+	NumUpvotes   int    `json:"num_upvotes"`
+	NumDownvotes int    `json:"num_downvotes"`
+	// Score is the number of upvotes less the number of downvotes.
+	Score  int       `json:"score"`
+	Author apiAuthor `json:"author"`
+}
+
+type apiCreateCommentInput struct {
+	ID       string `param:"id" json:"-" validate:"required,number"`
+	Content  string `json:"content" validate:"required,markdown"`
+	ParentID int    `json:"parent_id" validate:"omitempty,min=1"`
+}
+
+func newAPIComment(cm *data.Comment) apiComment {
+	ac := apiComment{
+		ID:           cm.ID,
+		CreatedAt:    cm.CreatedAt,
+		UpdatedAt:    cm.UpdatedAt,
+		DiscussionID: cm.DiscussionId,
+		Deleted:      cm.Deleted,
+		Content:      cm.Content,
+		NumUpvotes:   cm.NumUpvotes,
+		NumDownvotes: cm.NumDownvotes,
+		Score:        cm.Score,
+		Author: apiAuthor{
+			ID:        cm.UserId,
+			Name:      cm.U.Name,
+			AvatarUrl: services.AvatarVariant(cm.U.AvatarSrc, 64),
+		},
+	}
+	if cm.ParentId != 0 {
+		parentID := cm.ParentId
+		ac.ParentID = &parentID
+	}
+	if !cm.EditedAt.IsZero() {
+		editedAt := cm.EditedAt
+		ac.EditedAt = &editedAt
+	}
+	return ac
+}
+
+func newAPIComments(comments data.Comments) []apiComment {
+	res := make([]apiComment, len(comments))
+	for i := range comments {
+		res[i] = newAPIComment(&comments[i])
+	}
+	return res
+}
+
+// apiCommentsPageMeta counts all comments from the number
+// of comments left after the page.
+func apiCommentsPageMeta(page int, comments data.Comments, left int) apiPageMeta {
+	total := (page-1)*data.CommentsPerPage + len(comments) + left
+	return newAPIPageMeta(page, data.CommentsPerPage, total)
+}
+
+// apiGetCommentsHandler lists top level comments of the discussion,
+// replies are listed separately for each comment.
+func (app *application) apiGetCommentsHandler(c echo.Context) error {
+	var input apiIDPageInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+	discussionID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, "id is out of range")
+	}
+	if _, err := app.models.Discussions.Get(int64(discussionID)); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return apiError(c, http.StatusNotFound, "Discussion does not exist.")
+		}
+		return fmt.Errorf("in app#apiGetCommentsHandler: %w", err)
+	}
+	page := max(input.Page, 1)
+	comments, left, err := app.models.Comments.GetAllWithUser(discussionID, page)
+	if err != nil {
+		return fmt.Errorf("in app#apiGetCommentsHandler: %w", err)
+	}
+	return apiData(
+		c,
+		http.StatusOK,
+		newAPIComments(comments),
+		apiCommentsPageMeta(page, comments, left),
+	)
+}
+
+func (app *application) apiGetCommentRepliesHandler(c echo.Context) error {
+	var input apiIDPageInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+	commentID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, "id is out of range")
+	}
+	if _, err := app.models.Comments.GetDiscussionID(commentID); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return apiError(c, http.StatusNotFound, "Comment does not exist.")
+		}
+		return fmt.Errorf("in app#apiGetCommentRepliesHandler: %w", err)
+	}
+	page := max(input.Page, 1)
+	replies, left, err := app.models.Comments.GetAllChildren(commentID, page)
+	if err != nil {
+		return fmt.Errorf("in app#apiGetCommentRepliesHandler: %w", err)
+	}
+	return apiData(
+		c,
+		http.StatusOK,
+		newAPIComments(replies),
+		apiCommentsPageMeta(page, replies, left),
+	)
+}
+
+// apiCreateCommentHandler posts comment to the discussion, or reply
+// when parent_id of comment from the same discussion is given.
+func (app *application) apiCreateCommentHandler(c echo.Context) error {
+	var input apiCreateCommentInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+	discussionID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, "id is out of range")
+	}
+	if _, err := app.models.Discussions.Get(int64(discussionID)); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return apiError(c, http.StatusNotFound, "Discussion does not exist.")
+		}
+		return fmt.Errorf("in app#apiCreateCommentHandler: %w", err)
+	}
+	if input.ParentID != 0 {
+		parentDiscussionID, err := app.models.Comments.GetDiscussionID(input.ParentID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return apiFieldsError(c, map[string]string{"parent_id": "does not exist"})
+		case err != nil:
+			return fmt.Errorf("in app#apiCreateCommentHandler: %w", err)
+		case parentDiscussionID != discussionID:
+			return apiFieldsError(
+				c,
+				map[string]string{"parent_id": "belongs to another discussion"},
+			)
+		}
+	}
+
+	comment := &data.Comment{
+		UserId:       c.Get("userID").(int),
+		DiscussionId: discussionID,
+		Content:      input.Content,
+		ParentId:     input.ParentID,
+	}
+	if err := app.models.Comments.Insert(comment); err != nil {
+		return fmt.Errorf("in app#apiCreateCommentHandler: %w", err)
+	}
+	if comment.U.AvatarSrc, err = app.models.Users.AvatarSrcByID(comment.UserId); err != nil {
+		return fmt.Errorf("in app#apiCreateCommentHandler: %w", err)
+	}
+	if comment.U.Name, err = app.models.Users.GetUsername(comment.UserId); err != nil {
+		return fmt.Errorf("in app#apiCreateCommentHandler: %w", err)
+	}
+	return apiData(c, http.StatusCreated, newAPIComment(comment), nil)
+}
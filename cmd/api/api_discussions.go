@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/labstack/echo/v4"
+)
+
+type apiDiscussion struct {
+	ID            int       `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Title         string    `json:"title"`
+	Description   string    `json:"description"`
+	Url           string    `json:"url"`
+	CategoryID    int       `json:"category_id"`
+	UserID        int       `json:"user_id"`
+	NumUpvotes    int       `json:"num_upvotes"`
+	PreviewUrl    string    `json:"preview_url"`
+	PreviewStatus string    `json:"preview_status"`
+	SiteName      string    `json:"site_name"`
+}
+
+func newAPIDiscussion(d *data.Discussion) apiDiscussion {
+	previewUrl, previewStatus := discussionCardPreview(d)
+	return apiDiscussion{
+		ID:            d.ID,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+		Title:         d.Title,
+		Description:   d.Description,
+		Url:           d.Url,
+		CategoryID:    d.CategoryID,
+		UserID:        d.UserId,
+		NumUpvotes:    d.NumUpvotes,
+		PreviewUrl:    previewUrl,
+		PreviewStatus: previewStatus,
+		SiteName:      d.Metadata.SiteName,
+	}
+}
+
+type apiCategory struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+}
+
+type apiGetDiscussionsInput struct {
+	Page     int    `query:"page" validate:"omitempty,min=1"`
+	Category string `query:"category" validate:"max=64"`
+	Sort     string `query:"sort" validate:"omitempty,oneof=hot new top-day top-week top-all"`
+}
+
+type apiCreateDiscussionInput struct {
+	Title       string `json:"title" validate:"required,max=130"`
+	Description string `json:"description" validate:"required,markdown"`
+	Url         string `json:"url" validate:"required,url"`
+	CategoryID  int    `json:"category_id" validate:"required,min=1"`
+}
+
+func (app *application) apiGetDiscussionsHandler(c echo.Context) error {
+	var input apiGetDiscussionsInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+	page := max(input.Page, 1)
+	sort := data.ParseDiscussionSort(input.Sort)
+
+	discussions, err := app.models.Discussions.GetAll(input.Category, sort, page)
+	if err != nil {
+		return fmt.Errorf("in app#apiGetDiscussionsHandler: %w", err)
+	}
+	total, err := app.models.Discussions.Count(input.Category, sort)
+	if err != nil {
+		return fmt.Errorf("in app#apiGetDiscussionsHandler: %w", err)
+	}
+	res := make([]apiDiscussion, len(discussions))
+	for i := range discussions {
+		res[i] = newAPIDiscussion(&discussions[i])
+	}
+	return apiData(
+		c,
+		http.StatusOK,
+		res,
+		newAPIPageMeta(page, data.DiscussionsPerPage, total),
+	)
+}
+
+func (app *application) apiGetDiscussionHandler(c echo.Context) error {
+	var input apiIDInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+	id, err := strconv.ParseInt(input.ID, 10, 64)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, "id is out of range")
+	}
+	d, err := app.models.Discussions.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return apiError(c, http.StatusNotFound, "Discussion does not exist.")
+		}
+		return fmt.Errorf("in app#apiGetDiscussionHandler: %w", err)
+	}
+	return apiData(c, http.StatusOK, newAPIDiscussion(d), nil)
+}
+
+// apiCreateDiscussionHandler follows createDiscussionHandler, links
+// shared already are refused with conflict pointing to the discussion.
+func (app *application) apiCreateDiscussionHandler(c echo.Context) error {
+	var input apiCreateDiscussionInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+
+	canonicalUrl, err := data.CanonicalizeUrl(input.Url)
+	if err != nil {
+		return apiFieldsError(c, map[string]string{"url": "must be a valid URL"})
+	}
+	if err := app.services.UrlGuard.Check(input.Url); err != nil {
+		return apiFieldsError(c, map[string]string{"url": unsafeUrlErrMsg(err)})
+	}
+	categories, err := app.models.Categories.GetAll()
+	if err != nil {
+		return fmt.Errorf("in app#apiCreateDiscussionHandler: %w", err)
+	}
+	if !slices.ContainsFunc(categories, func(cat data.Category) bool {
+		return cat.ID == input.CategoryID
+	}) {
+		return apiFieldsError(c, map[string]string{"category_id": "does not exist"})
+	}
+	switch existing, err := app.models.Discussions.GetByCanonicalUrl(canonicalUrl); {
+	case err == nil:
+		return apiAlreadyShared(c, existing)
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return fmt.Errorf("in app#apiCreateDiscussionHandler: %w", err)
+	}
+
+	d := &data.Discussion{
+		Title:        input.Title,
+		Url:          input.Url,
+		CanonicalUrl: canonicalUrl,
+		Description:  input.Description,
+		CategoryID:   input.CategoryID,
+		UserId:       c.Get("userID").(int),
+	}
+	if err := app.models.Discussions.Insert(d); err != nil {
+		if errors.Is(err, data.ErrDuplicatedUrl) {
+			// Someone shared the same resource in the meantime
+			existing, err := app.models.Discussions.GetByCanonicalUrl(canonicalUrl)
+			if err == nil {
+				return apiAlreadyShared(c, existing)
+			}
+		}
+		return fmt.Errorf("in app#apiCreateDiscussionHandler: %w", err)
+	}
+
+	c.Response().Header().Set(
+		echo.HeaderLocation,
+		fmt.Sprintf("/api/v1/discussions/%d", d.ID),
+	)
+	return apiData(c, http.StatusCreated, newAPIDiscussion(d), nil)
+}
+
+func apiAlreadyShared(c echo.Context, existing *data.Discussion) error {
+	c.Response().Header().Set(
+		echo.HeaderLocation,
+		fmt.Sprintf("/api/v1/discussions/%d", existing.ID),
+	)
+	return apiError(
+		c,
+		http.StatusConflict,
+		fmt.Sprintf("This link has already been shared in discussion %d.", existing.ID),
+	)
+}
+
+func (app *application) apiGetCategoriesHandler(c echo.Context) error {
+	categories, err := app.models.Categories.GetAll()
+	if err != nil {
+		return fmt.Errorf("in app#apiGetCategoriesHandler: %w", err)
+	}
+	res := make([]apiCategory, len(categories))
+	for i, cat := range categories {
+		res[i] = apiCategory{
+			ID:        cat.ID,
+			CreatedAt: cat.CreatedAt,
+			UpdatedAt: cat.UpdatedAt,
+			Name:      cat.Name,
+		}
+	}
+	return apiData(c, http.StatusOK, res, nil)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// apiUser holds public profile of the user, email is never exposed.
+type apiUser struct {
+	ID          int       `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name"`
+	AvatarUrl   string    `json:"avatar_url"`
+	Description string    `json:"description"`
+	Activated   bool      `json:"activated"`
+}
+
+type apiReport struct {
+	ID           int       `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	ReportedUser apiAuthor `json:"reported_user"`
+	// Reported content, exactly one of them is set.
+	DiscussionID *int   `json:"discussion_id"`
+	CommentID    *int   `json:"comment_id"`
+	Reason       string `json:"reason"`
+}
+
+type apiGetReportsInput struct {
+	After int `query:"after" validate:"min=0"`
+	Limit int `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+type apiCreateReportInput struct {
+	UserID       int    `json:"user_id" validate:"required,min=1"`
+	Reason       string `json:"reason" validate:"required,max=255"`
+	DiscussionID int    `json:"discussion_id" validate:"omitempty,min=1"`
+	CommentID    int    `json:"comment_id" validate:"omitempty,min=1"`
+}
+
+func newAPIReport(r *data.Report) apiReport {
+	ar := apiReport{
+		ID:        r.ID,
+		CreatedAt: r.CreatedAt,
+		ReportedUser: apiAuthor{
+			ID:        r.ReportedUserID,
+			Name:      r.ReportedUser.Name,
+			AvatarUrl: services.AvatarVariant(r.ReportedUser.AvatarSrc, 64),
+		},
+		Reason: r.Reason,
+	}
+	if r.DiscussionID != 0 {
+		discussionID := r.DiscussionID
+		ar.DiscussionID = &discussionID
+	}
+	if r.CommentID != 0 {
+		commentID := r.CommentID
+		ar.CommentID = &commentID
+	}
+	return ar
+}
+
+func (app *application) apiGetUserHandler(c echo.Context) error {
+	var input apiIDInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+	uID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, "id is out of range")
+	}
+	email, err := app.models.Users.GetEmail(uID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apiError(c, http.StatusNotFound, "User does not exist.")
+		}
+		return fmt.Errorf("in app#apiGetUserHandler: %w", err)
+	}
+	u, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		return fmt.Errorf("in app#apiGetUserHandler: %w", err)
+	}
+	return apiData(c, http.StatusOK, apiUser{
+		ID:          u.ID,
+		CreatedAt:   u.CreatedAt,
+		Name:        u.Name,
+		AvatarUrl:   services.AvatarVariant(u.AvatarSrc, 256),
+		Description: u.Description,
+		Activated:   u.Activated,
+	}, nil)
+}
+
+// apiGetReportsHandler lists reports the way the moderation
+// panel polls them, after the id of the last seen report.
+func (app *application) apiGetReportsHandler(c echo.Context) error {
+	var input apiGetReportsInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+	limit := input.Limit
+	if limit == 0 {
+		limit = 20
+	}
+	// One more report tells whether there is a next page
+	reports, err := app.models.Reports.GetAll(input.After, limit+1)
+	if err != nil {
+		return fmt.Errorf("in app#apiGetReportsHandler: %w", err)
+	}
+	meta := apiCursorMeta{Limit: limit}
+	if len(reports) > limit {
+		reports = reports[:limit]
+		nextCursor := reports[limit-1].ID
+		meta.NextCursor = &nextCursor
+	}
+	res := make([]apiReport, len(reports))
+	for i := range reports {
+		res[i] = newAPIReport(&reports[i])
+	}
+	return apiData(c, http.StatusOK, res, meta)
+}
+
+// apiCreateReportHandler follows reportUserHandler, the user
+// is reported either for the discussion or for the comment.
+func (app *application) apiCreateReportHandler(c echo.Context) error {
+	var input apiCreateReportInput
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return apiValidationError(c, &input, err)
+	}
+	if (input.DiscussionID == 0) == (input.CommentID == 0) {
+		msg := "exactly one of discussion_id and comment_id is required"
+		return apiFieldsError(c, map[string]string{
+			"discussion_id": msg,
+			"comment_id":    msg,
+		})
+	}
+	reporterID := c.Get("userID").(int)
+	if input.UserID == reporterID {
+		return apiFieldsError(c, map[string]string{"user_id": "you cannot report yourself"})
+	}
+	exists, err := app.models.Users.Exists(input.UserID)
+	if err != nil {
+		return fmt.Errorf("in app#apiCreateReportHandler: %w", err)
+	}
+	if !exists {
+		return apiFieldsError(c, map[string]string{"user_id": "does not exist"})
+	}
+	admin, err := app.models.Users.HasRole(input.UserID, "admin")
+	if err != nil {
+		return fmt.Errorf("in app#apiCreateReportHandler: %w", err)
+	}
+	if admin {
+		return apiFieldsError(c, map[string]string{"user_id": "admin cannot be reported"})
+	}
+	if input.DiscussionID != 0 {
+		_, err = app.models.Discussions.Get(int64(input.DiscussionID))
+	} else {
+		_, err = app.models.Comments.GetDiscussionID(input.CommentID)
+	}
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound) && input.DiscussionID != 0:
+		return apiFieldsError(c, map[string]string{"discussion_id": "does not exist"})
+	case errors.Is(err, data.ErrRecordNotFound):
+		return apiFieldsError(c, map[string]string{"comment_id": "does not exist"})
+	case err != nil:
+		return fmt.Errorf("in app#apiCreateReportHandler: %w", err)
+	}
+
+	r := &data.Report{
+		UserID:         reporterID,
+		ReportedUserID: input.UserID,
+		DiscussionID:   input.DiscussionID,
+		CommentID:      input.CommentID,
+		Reason:         input.Reason,
+	}
+	if err := app.models.Reports.Insert(r); err != nil {
+		if errors.Is(err, data.ErrUniquenessViolation) {
+			return apiError(
+				c,
+				http.StatusConflict,
+				"You can't report same user twice for the same thing.",
+			)
+		}
+		return fmt.Errorf("in app#apiCreateReportHandler: %w", err)
+	}
+	r.ReportedUser.Name, err = app.models.Users.GetUsername(r.ReportedUserID)
+	if err != nil {
+		return fmt.Errorf("in app#apiCreateReportHandler: %w", err)
+	}
+	r.ReportedUser.AvatarSrc, err = app.models.Users.AvatarSrcByID(r.ReportedUserID)
+	if err != nil {
+		return fmt.Errorf("in app#apiCreateReportHandler: %w", err)
+	}
+	return apiData(c, http.StatusCreated, newAPIReport(r), nil)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/N0tR1CH/sad/internal/services"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/components"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/labstack/echo/v4"
+)
+
+// saveAvatar stores avatar uploaded within the form, if any.
+// Empty source is returned when no file was sent.
+func (app *application) saveAvatar(c echo.Context) (string, error) {
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return "", nil
+		}
+		return "", fmt.Errorf("in app#saveAvatar: %w", err)
+	}
+	// Declared size is checked upfront, the service
+	// limits the actual number of bytes read anyway.
+	if file.Size > services.MaxAvatarSize {
+		return "", services.ErrAvatarTooLarge
+	}
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("in app#saveAvatar: %w", err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	return app.services.Avatars.Save(src)
+}
+
+// avatarErrMsg explains to the user why the avatar was rejected.
+func avatarErrMsg(err error) string {
+	switch {
+	case errors.Is(err, services.ErrAvatarTooLarge):
+		return fmt.Sprintf(
+			"Avatar must be smaller than %dMB.",
+			services.MaxAvatarSize>>20,
+		)
+	case errors.Is(err, services.ErrAvatarUnsupported):
+		return "Avatar must be a jpeg, png, gif or webp image."
+	case errors.Is(err, services.ErrAvatarDimensions):
+		return "Avatar must be between 32 and 8000 pixels wide and high."
+	default:
+		return "Avatar could not be saved. Try again."
+	}
+}
+
+func (app *application) editUserAvatarHandler(c echo.Context) error {
+	var input struct {
+		ID string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return err
+	}
+	uID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return err
+	}
+	if uID != c.Get("userID").(int) {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return views.Render(
+		c,
+		http.StatusOK,
+		pages.ChangeAvatarForm(pages.ChangeAvatarFormViewModel{Id: uID}),
+	)
+}
+
+func (app *application) updateUserAvatarHandler(c echo.Context) error {
+	var input struct {
+		ID string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return err
+	}
+	uID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return err
+	}
+	if uID != c.Get("userID").(int) {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	src, err := app.saveAvatar(c)
+	if err == nil && src == "" {
+		err = services.ErrAvatarUnsupported
+	}
+	if err != nil {
+		app.logger.Info("app#updateUserAvatarHandler", "err", err.Error())
+		return views.Render(
+			c,
+			http.StatusBadRequest,
+			pages.ChangeAvatarForm(
+				pages.ChangeAvatarFormViewModel{Id: uID, ErrMsg: avatarErrMsg(err)},
+			),
+		)
+	}
+
+	oldSrc, err := app.models.Users.UpdateAvatar(uID, src)
+	if err != nil {
+		_ = app.services.Avatars.Remove(src)
+		return fmt.Errorf("in app#updateUserAvatarHandler: %w", err)
+	}
+	if oldSrc != "" {
+		app.startBackgroundJob(func() {
+			if err := app.services.Avatars.Remove(oldSrc); err != nil {
+				app.logger.Error("app#updateUserAvatarHandler", "err", err.Error())
+			}
+		})
+	}
+
+	c.Response().Header().Set("HX-Location", fmt.Sprintf("/users/%d", uID))
+	app.sessionManager.Put(
+		c.Request().Context(),
+		"alert",
+		components.AlertProps{
+			Title: "Avatar changed!",
+			Text:  "Your new avatar is already visible to others.",
+			Icon:  components.Success,
+		},
+	)
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/N0tR1CH/sad/internal/data"
+)
+
+// canonicalUrlBackfillBatch is the number of discussions
+// read at once by the backfill.
+const canonicalUrlBackfillBatch = 100
+
+// startCanonicalUrlBackfill sets canonical urls of discussions shared
+// before they were introduced, so their links are deduplicated too.
+// Of discussions sharing the same resource, the oldest one gets the
+// url. It stops once ctx is done and is tracked by the wait group.
+func (app *application) startCanonicalUrlBackfill(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		n, err := app.backfillCanonicalUrls(ctx)
+		if err != nil {
+			app.logger.Error("app#startCanonicalUrlBackfill", "err", err.Error())
+		}
+		if n > 0 {
+			app.logger.Info("canonical urls of discussions backfilled", "count", n)
+		}
+	}()
+}
+
+func (app *application) backfillCanonicalUrls(ctx context.Context) (int, error) {
+	var afterId, n int
+	for ctx.Err() == nil {
+		urls, err := app.models.Discussions.WithoutCanonicalUrl(
+			afterId,
+			canonicalUrlBackfillBatch,
+		)
+		if err != nil {
+			return n, fmt.Errorf("in app#backfillCanonicalUrls: %w", err)
+		}
+		if len(urls) == 0 {
+			return n, nil
+		}
+		for _, du := range urls {
+			afterId = du.ID
+			canonicalUrl, err := data.CanonicalizeUrl(du.Url)
+			if err != nil {
+				continue
+			}
+			err = app.models.Discussions.SetCanonicalUrl(du.ID, canonicalUrl)
+			switch {
+			case errors.Is(err, data.ErrDuplicatedUrl), errors.Is(err, data.ErrRecordNotFound):
+				// Older discussion shares the resource or
+				// the discussion got its url in the meantime
+			case err != nil:
+				return n, fmt.Errorf("in app#backfillCanonicalUrls: %w", err)
+			default:
+				n++
+			}
+		}
+	}
+	return n, nil
+}
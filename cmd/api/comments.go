@@ -3,11 +3,18 @@ package main
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/markdown"
+	"github.com/N0tR1CH/sad/internal/services"
 	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/components"
 	"github.com/N0tR1CH/sad/views/pages"
 	"github.com/labstack/echo/v4"
 )
@@ -15,7 +22,7 @@ import (
 func (app *application) createCommentHandler(c echo.Context) error {
 	var input struct {
 		DiscussionId string `param:"discussionId" validate:"required,number"`
-		Content      string `form:"content" validate:"required"`
+		Content      string `form:"content" validate:"required,markdown"`
 	}
 	if err := c.Bind(&input); err != nil {
 		return err
@@ -41,7 +48,8 @@ func (app *application) createCommentHandler(c echo.Context) error {
 		)
 	}
 	comment := new(data.Comment)
-	comment.UserId = app.sessionManager.GetInt(c.Request().Context(), "userID")
+	// Set by the session or the personal access token
+	comment.UserId = c.Get("userID").(int)
 	comment.Content = input.Content
 	comment.DiscussionId = discussionId
 
@@ -55,42 +63,38 @@ func (app *application) createCommentHandler(c echo.Context) error {
 	if err := app.models.Comments.Insert(comment); err != nil {
 		return err
 	}
-	imgSrc, err := app.models.Users.AvatarSrcByID(comment.UserId)
+	comment.U.AvatarSrc, err = app.models.Users.AvatarSrcByID(comment.UserId)
 	if err != nil {
 		return err
 	}
-	username, err := app.models.Users.GetUsername(comment.UserId)
+	comment.U.Name, err = app.models.Users.GetUsername(comment.UserId)
 	if err != nil {
 		return err
 	}
-	return views.Render(
-		c,
-		http.StatusOK,
-		pages.Comment(
-			pages.NewCommentViewModel(
-				username,
-				imgSrc,
-				comment.Content,
-				comment.CreatedAt,
-				comment.NumUpvotes,
-				comment.DiscussionId,
-				comment.ID,
-				comment.UserId,
-			),
-		),
-	)
+	viewer, err := app.commentViewer(c)
+	if err != nil {
+		return err
+	}
+	cvm, err := app.newCommentViewModel(viewer, comment)
+	if err != nil {
+		return err
+	}
+	return views.Render(c, http.StatusOK, pages.Comment(cvm))
 }
 
 func (app *application) getCommentsHandler(c echo.Context) error {
 	var input struct {
 		DiscussionId string `param:"discussionId" validate:"required,number"`
+		Page         int    `query:"page"`
+		Until        int    `query:"until"`
+		Sort         string `query:"sort"`
 	}
 
 	if err := c.Bind(&input); err != nil {
-		return fmt.Errorf("in app#getCommentHandler: %w", err)
+		return fmt.Errorf("in app#getCommentsHandler: %w", err)
 	}
 	if err := c.Validate(&input); err != nil {
-		return fmt.Errorf("in app#getCommentHandler: %w", err)
+		return fmt.Errorf("in app#getCommentsHandler: %w", err)
 	}
 	if !c.Get("HTMX").(bool) {
 		return c.Redirect(
@@ -100,128 +104,541 @@ func (app *application) getCommentsHandler(c echo.Context) error {
 	}
 	discussionId, err := strconv.Atoi(input.DiscussionId)
 	if err != nil {
-		return fmt.Errorf("in app#getCommentHandler: %w", err)
+		return fmt.Errorf("in app#getCommentsHandler: %w", err)
 	}
-	page, err := strconv.Atoi(c.QueryParam("page"))
+	page := max(input.Page, 1)
+	sort := data.ParseCommentSort(input.Sort)
+
+	viewer, err := app.commentViewer(c)
 	if err != nil {
-		page = 1
+		return fmt.Errorf("in app#getCommentsHandler: %w", err)
 	}
-
-	comments, currCommCount, err := app.models.Comments.GetAllWithUser(discussionId, page)
+	thread, err := app.models.Comments.GetThread(
+		discussionId,
+		0,
+		viewer.id,
+		sort,
+		page,
+		input.Until,
+	)
 	if err != nil {
-		return fmt.Errorf("in app#getCommentHandler: %w", err)
+		return fmt.Errorf("in app#getCommentsHandler: %w", err)
 	}
-	cvms := make([]pages.CommentViewModel, len(comments))
-	for i := range cvms {
-		vm := pages.NewCommentViewModel(
-			comments[i].U.Name,
-			comments[i].U.AvatarSrc,
-			comments[i].Content,
-			comments[i].CreatedAt,
-			comments[i].NumUpvotes,
-			comments[i].DiscussionId,
-			comments[i].ID,
-			comments[i].UserId,
-		)
-		cvms[i] = vm
+	cvms, err := app.commentViewModels(viewer, thread.Comments)
+	if err != nil {
+		return fmt.Errorf("in app#getCommentsHandler: %w", err)
 	}
 	return views.Render(
 		c,
 		http.StatusOK,
-		pages.Comments(cvms, discussionId, page+1, currCommCount, 0),
+		pages.Comments(
+			pages.CommentsViewModel{
+				Comments: cvms,
+				NextPageUrl: commentsPageUrl(
+					fmt.Sprintf("/discussions/%d/comments", discussionId),
+					thread,
+					sort,
+					page+1,
+				),
+			},
+		),
 	)
 }
 
 func (app *application) upvoteCommentHandler(c echo.Context) error {
-	var input struct {
-		CommentId string `param:"id" validate:"required,number"`
+	return app.voteComment(c, 1)
+}
+
+// downvoteCommentHandler requires the reputation set by the
+// downvote-min-reputation flag, administrators can always downvote.
+func (app *application) downvoteCommentHandler(c echo.Context) error {
+	return app.voteComment(c, -1)
+}
+
+// voteComment toggles vote of the user on the comment and responds
+// with the votes of the comment as the user sees them afterwards.
+func (app *application) voteComment(c echo.Context, value int) error {
+	cm, err := app.commentFromParams(c)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return fmt.Errorf("in app#voteComment: %w", err)
 	}
-	if err := c.Bind(&input); err != nil {
-		return fmt.Errorf("in app#updateCommentHandler: %w", err)
+	viewer, err := app.commentViewer(c)
+	if err != nil {
+		return fmt.Errorf("in app#voteComment: %w", err)
 	}
-	if err := c.Validate(&input); err != nil {
-		return fmt.Errorf("in app#updateCommentHandler: %w", err)
+	if viewer.id == 0 {
+		return errors.New("userID should be in the request context")
 	}
-	cId, err := strconv.Atoi(input.CommentId)
+	canDownvote, err := viewer.canDownvote()
 	if err != nil {
-		return fmt.Errorf("in app#updateCommentHandler: %w", err)
+		return fmt.Errorf("in app#voteComment: %w", err)
 	}
-	var userId int
-	if uId, ok := c.Get("userID").(int); !ok || uId == 0 {
-		return errors.New("userID should be in the request context")
-	} else {
-		userId = uId
+	// Downvote is retracted the same way it is cast,
+	// so users can withdraw it without the reputation.
+	if value < 0 && !canDownvote {
+		vote, err := app.models.Comments.ViewerVote(viewer.id, cm.ID)
+		if err != nil {
+			return fmt.Errorf("in app#voteComment: %w", err)
+		}
+		if vote != -1 {
+			return c.String(http.StatusForbidden, app.downvoteHint(viewer)+".")
+		}
 	}
-	if err := app.models.Comments.Upvote(userId, cId); err != nil {
-		if errors.Is(err, data.ErrUniquenessViolation) {
-			return c.NoContent(http.StatusConflict)
+	score, vote, err := app.models.Comments.Vote(viewer.id, cm.ID, value)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return c.NoContent(http.StatusNotFound)
 		}
-		return fmt.Errorf("in app#updateCommentHandler: %w", err)
+		return fmt.Errorf("in app#voteComment: %w", err)
 	}
-	return c.NoContent(http.StatusOK)
+	return views.Render(
+		c,
+		http.StatusOK,
+		components.CommentVotes(
+			components.CommentVotesViewModel{
+				DiscussionId: cm.DiscussionId,
+				CommentId:    cm.ID,
+				Score:        score,
+				Vote:         vote,
+				CanDownvote:  canDownvote,
+				DownvoteHint: app.downvoteHint(viewer),
+			},
+		),
+	)
 }
 
+// getCommentRepliesHandler shows the thread below the comment,
+// with the comment itself on the first page.
 func (app *application) getCommentRepliesHandler(c echo.Context) error {
 	var input struct {
-		DiscussionId string `param:"discussionId" validate:"required,number"`
-		CommentId    string `param:"id" validate:"required,number"`
-		Page         string `query:"page" validate:"required,number"`
+		Page  int    `query:"page"`
+		Until int    `query:"until"`
+		Sort  string `query:"sort"`
 	}
 	if err := c.Bind(&input); err != nil {
 		return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
 	}
-	if err := c.Validate(&input); err != nil {
-		return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
-	}
 	if !c.Get("HTMX").(bool) {
 		return c.Redirect(
 			http.StatusTemporaryRedirect,
-			fmt.Sprintf("/discussions/%s", input.DiscussionId),
+			fmt.Sprintf("/discussions/%s", c.Param("discussionId")),
 		)
 	}
-	discussionId, err := strconv.Atoi(input.DiscussionId)
+	parent, err := app.commentFromParams(c)
 	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
 		return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
 	}
-	page, err := strconv.Atoi(input.Page)
+	page := max(input.Page, 1)
+	sort := data.ParseCommentSort(input.Sort)
+
+	viewer, err := app.commentViewer(c)
 	if err != nil {
-		page = 1
+		return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
 	}
-	commentParentId, err := strconv.Atoi(input.CommentId)
+	thread, err := app.models.Comments.GetThread(
+		parent.DiscussionId,
+		parent.ID,
+		viewer.id,
+		sort,
+		page,
+		input.Until,
+	)
 	if err != nil {
 		return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
 	}
+	cvms, err := app.commentViewModels(viewer, thread.Comments)
+	if err != nil {
+		return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
+	}
+	replies := pages.CommentsViewModel{
+		Comments: cvms,
+		NextPageUrl: commentsPageUrl(
+			fmt.Sprintf("/discussions/%d/comments/%d/reply", parent.DiscussionId, parent.ID),
+			thread,
+			sort,
+			page+1,
+		),
+	}
+	if page > 1 {
+		return views.Render(c, http.StatusOK, pages.Comments(replies))
+	}
+	if viewer.id != 0 {
+		if parent.ViewerVote, err = app.models.Comments.ViewerVote(viewer.id, parent.ID); err != nil {
+			return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
+		}
+	}
+	pcvm, err := app.newCommentViewModel(viewer, parent)
+	if err != nil {
+		return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
+	}
+	return views.Render(
+		c,
+		http.StatusOK,
+		pages.CommentThreadPage(
+			pages.CommentThreadPageViewModel{
+				DiscussionId: parent.DiscussionId,
+				Parent:       pcvm,
+				Replies:      replies,
+			},
+		),
+	)
+}
+
+var errCommentNotModifiable = errors.New("comment can be modified only by its author")
+
+// commentViewer is the user comments are rendered for.
+type commentViewer struct {
+	id    int
+	admin bool
+	// canDownvote tells whether the viewer has the reputation needed
+	// to downvote. Reputation is computed from all votes on the posts
+	// of the viewer, so it is computed at most once per request and
+	// only when the downvote button is rendered or pressed.
+	canDownvote func() (bool, error)
+}
+
+func (app *application) commentViewer(c echo.Context) (commentViewer, error) {
+	v := commentViewer{id: c.Get("userID").(int)}
+	v.canDownvote = func() (bool, error) { return false, nil }
+	if v.id == 0 {
+		return v, nil
+	}
+	admin, err := app.models.Users.HasRole(v.id, "admin")
+	if err != nil {
+		return v, fmt.Errorf("in app#commentViewer: %w", err)
+	}
+	v.admin = admin
+	v.canDownvote = sync.OnceValues(func() (bool, error) {
+		if admin {
+			return true, nil
+		}
+		reputation, err := app.models.Users.Reputation(v.id)
+		if err != nil {
+			return false, fmt.Errorf("in app#commentViewer: %w", err)
+		}
+		return reputation >= app.config.comments.downvoteReputation, nil
+	})
+	return v, nil
+}
 
-	comments, currCommCount, err := app.models.Comments.GetAllChildren(
-		commentParentId,
-		page,
+// downvoteHint explains why the viewer can not downvote.
+func (app *application) downvoteHint(v commentViewer) string {
+	if v.id == 0 {
+		return "Log in to downvote"
+	}
+	return fmt.Sprintf(
+		"You need %d reputation to downvote",
+		app.config.comments.downvoteReputation,
 	)
+}
+
+// commentEditable tells whether the viewer is the author of the
+// comment and the edit window has not passed yet.
+func (app *application) commentEditable(v commentViewer, cm *data.Comment) bool {
+	return !cm.Deleted &&
+		v.id != 0 &&
+		cm.UserId == v.id &&
+		time.Since(cm.CreatedAt) < app.config.comments.editWindow
+}
+
+// commentDeletable tells whether the viewer is the author
+// of the comment or an administrator.
+func (app *application) commentDeletable(v commentViewer, cm *data.Comment) bool {
+	return !cm.Deleted && v.id != 0 && (cm.UserId == v.id || v.admin)
+}
+
+func (app *application) newCommentViewModel(
+	v commentViewer,
+	cm *data.Comment,
+) (pages.CommentViewModel, error) {
+	content, err := renderMarkdown(cm.Content)
 	if err != nil {
-		return fmt.Errorf("in app#getCommentRepliesHandler: %w", err)
+		return pages.CommentViewModel{}, err
 	}
+	canDownvote, err := v.canDownvote()
+	if err != nil {
+		return pages.CommentViewModel{}, err
+	}
+	return pages.NewCommentViewModel(
+		cm.U.Name,
+		services.AvatarVariant(cm.U.AvatarSrc, 64),
+		content,
+		cm.CreatedAt,
+		cm.Score,
+		cm.DiscussionId,
+		cm.ID,
+		cm.UserId,
+		pages.CommentState{
+			EditedAt:     cm.EditedAt,
+			Deleted:      cm.Deleted,
+			CanEdit:      app.commentEditable(v, cm),
+			CanDelete:    app.commentDeletable(v, cm),
+			Vote:         cm.ViewerVote,
+			CanDownvote:  canDownvote,
+			DownvoteHint: app.downvoteHint(v),
+		},
+	), nil
+}
+
+// commentViewModels converts the thread loaded by GetThread,
+// replies are nested below their parents.
+func (app *application) commentViewModels(
+	v commentViewer,
+	comments data.Comments,
+) ([]pages.CommentViewModel, error) {
 	cvms := make([]pages.CommentViewModel, len(comments))
-	for i := range cvms {
-		vm := pages.NewCommentViewModel(
-			comments[i].U.Name,
-			comments[i].U.AvatarSrc,
-			comments[i].Content,
-			comments[i].CreatedAt,
-			comments[i].NumUpvotes,
-			comments[i].DiscussionId,
-			comments[i].ID,
-			comments[i].UserId,
+	for i := range comments {
+		cvm, err := app.newCommentViewModel(v, &comments[i])
+		if err != nil {
+			return nil, err
+		}
+		replies, err := app.commentViewModels(v, comments[i].Replies)
+		if err != nil {
+			return nil, err
+		}
+		// Replies too deep or beyond RepliesPerComment
+		// are loaded as thread of the comment
+		cvms[i] = cvm.WithReplies(replies, comments[i].NumReplies-len(replies))
+	}
+	return cvms, nil
+}
+
+// commentsPageUrl returns url of the following page of the thread,
+// it is empty when there are no more comments.
+func commentsPageUrl(
+	path string,
+	thread *data.CommentThread,
+	sort data.CommentSort,
+	page int,
+) string {
+	if thread.Left <= 0 {
+		return ""
+	}
+	params := url.Values{}
+	params.Set("page", strconv.Itoa(page))
+	params.Set("sort", string(sort))
+	params.Set("until", strconv.Itoa(thread.Until))
+	return path + "?" + params.Encode()
+}
+
+// commentFromParams retrieves comment of the discussion from the path params.
+func (app *application) commentFromParams(c echo.Context) (*data.Comment, error) {
+	var input struct {
+		DiscussionId string `param:"discussionId" validate:"required,number"`
+		CommentId    string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+	if err := c.Validate(&input); err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+	discussionId, err := strconv.Atoi(input.DiscussionId)
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+	commentId, err := strconv.Atoi(input.CommentId)
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+	cm, err := app.models.Comments.Get(commentId)
+	if err != nil {
+		return nil, err
+	}
+	if cm.DiscussionId != discussionId {
+		return nil, data.ErrRecordNotFound
+	}
+	return cm, nil
+}
+
+func (app *application) commentModificationFailed(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return c.NoContent(http.StatusNotFound)
+	case errors.Is(err, errCommentNotModifiable):
+		return c.NoContent(http.StatusForbidden)
+	default:
+		return err
+	}
+}
+
+// renderComment responds with the comment as the viewer sees it.
+func (app *application) renderComment(c echo.Context, cm *data.Comment) error {
+	viewer, err := app.commentViewer(c)
+	if err != nil {
+		return err
+	}
+	if viewer.id != 0 {
+		if cm.ViewerVote, err = app.models.Comments.ViewerVote(viewer.id, cm.ID); err != nil {
+			return err
+		}
+	}
+	cvm, err := app.newCommentViewModel(viewer, cm)
+	if err != nil {
+		return err
+	}
+	return views.Render(c, http.StatusOK, pages.Comment(cvm))
+}
+
+// commentMinutesLeft is the time left to edit the comment, rounded up.
+func (app *application) commentMinutesLeft(cm *data.Comment) int {
+	left := time.Until(cm.CreatedAt.Add(app.config.comments.editWindow))
+	return max(int(math.Ceil(left.Minutes())), 0)
+}
+
+func (app *application) getCommentHandler(c echo.Context) error {
+	if !c.Get("HTMX").(bool) {
+		return c.Redirect(
+			http.StatusTemporaryRedirect,
+			fmt.Sprintf("/discussions/%s", c.Param("discussionId")),
+		)
+	}
+	cm, err := app.commentFromParams(c)
+	if err != nil {
+		return app.commentModificationFailed(c, err)
+	}
+	return app.renderComment(c, cm)
+}
+
+func (app *application) editCommentHandler(c echo.Context) error {
+	if !c.Get("HTMX").(bool) {
+		return c.Redirect(
+			http.StatusTemporaryRedirect,
+			fmt.Sprintf("/discussions/%s", c.Param("discussionId")),
 		)
-		cvms[i] = vm
+	}
+	cm, err := app.commentFromParams(c)
+	if err != nil {
+		return app.commentModificationFailed(c, err)
+	}
+	viewer, err := app.commentViewer(c)
+	if err != nil {
+		return fmt.Errorf("in app#editCommentHandler: %w", err)
+	}
+	if !app.commentEditable(viewer, cm) {
+		return app.commentModificationFailed(c, errCommentNotModifiable)
 	}
 	return views.Render(
 		c,
 		http.StatusOK,
-		pages.Comments(
-			cvms,
-			discussionId,
-			page+1,
-			currCommCount,
-			commentParentId,
+		pages.CommentEditForm(
+			pages.CommentEditFormViewModel{
+				DiscussionId: cm.DiscussionId,
+				CommentId:    cm.ID,
+				Content:      cm.Content,
+				MinutesLeft:  app.commentMinutesLeft(cm),
+			},
 		),
 	)
 }
+
+func (app *application) updateCommentHandler(c echo.Context) error {
+	cm, err := app.commentFromParams(c)
+	if err != nil {
+		return app.commentModificationFailed(c, err)
+	}
+	viewer, err := app.commentViewer(c)
+	if err != nil {
+		return fmt.Errorf("in app#updateCommentHandler: %w", err)
+	}
+	if cm.Deleted || cm.UserId != viewer.id {
+		return app.commentModificationFailed(c, errCommentNotModifiable)
+	}
+
+	var input struct {
+		Content string `form:"content" validate:"required,markdown"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	cefvm := pages.CommentEditFormViewModel{
+		DiscussionId: cm.DiscussionId,
+		CommentId:    cm.ID,
+		Content:      input.Content,
+		MinutesLeft:  app.commentMinutesLeft(cm),
+	}
+	switch {
+	case !app.commentEditable(viewer, cm):
+		cefvm.ErrMsg = fmt.Sprintf(
+			"Comments can be edited only within %d minutes after posting.",
+			int(app.config.comments.editWindow.Minutes()),
+		)
+	case c.Validate(&input) != nil:
+		cefvm.ErrMsg = fmt.Sprintf(
+			"Comment can not be empty nor longer than %d characters.",
+			markdown.MaxLength,
+		)
+	}
+	if cefvm.ErrMsg != "" {
+		return views.Render(c, http.StatusBadRequest, pages.CommentEditForm(cefvm))
+	}
+
+	// Saving the same content would only add a revision.
+	if input.Content == cm.Content {
+		return app.renderComment(c, cm)
+	}
+	cm.Content = input.Content
+	if err := app.models.Comments.Update(cm); err != nil {
+		return app.commentModificationFailed(
+			c,
+			fmt.Errorf("in app#updateCommentHandler: %w", err),
+		)
+	}
+	return app.renderComment(c, cm)
+}
+
+// deleteCommentHandler replaces the comment with a tombstone,
+// so replies to it stay in the discussion.
+func (app *application) deleteCommentHandler(c echo.Context) error {
+	cm, err := app.commentFromParams(c)
+	if err != nil {
+		return app.commentModificationFailed(c, err)
+	}
+	viewer, err := app.commentViewer(c)
+	if err != nil {
+		return fmt.Errorf("in app#deleteCommentHandler: %w", err)
+	}
+	if !app.commentDeletable(viewer, cm) {
+		return app.commentModificationFailed(c, errCommentNotModifiable)
+	}
+	if err := app.models.Comments.Delete(cm.ID); err != nil {
+		return app.commentModificationFailed(
+			c,
+			fmt.Errorf("in app#deleteCommentHandler: %w", err),
+		)
+	}
+	cm, err = app.models.Comments.Get(cm.ID)
+	if err != nil {
+		return fmt.Errorf("in app#deleteCommentHandler: %w", err)
+	}
+	return app.renderComment(c, cm)
+}
+
+func (app *application) getCommentRevisionsHandler(c echo.Context) error {
+	cm, err := app.commentFromParams(c)
+	if err != nil {
+		return app.commentModificationFailed(c, err)
+	}
+	revs, err := app.models.Comments.Revisions(cm.ID)
+	if err != nil {
+		return fmt.Errorf("in app#getCommentRevisionsHandler: %w", err)
+	}
+	crvms := make([]pages.CommentRevisionViewModel, len(revs))
+	for i := range revs {
+		content, err := renderMarkdown(revs[i].Content)
+		if err != nil {
+			return fmt.Errorf("in app#getCommentRevisionsHandler: %w", err)
+		}
+		crvms[i] = pages.CommentRevisionViewModel{
+			ReplacedAt: revs[i].CreatedAt,
+			Content:    content,
+		}
+	}
+	return views.Render(c, http.StatusOK, pages.CommentRevisions(crvms))
+}
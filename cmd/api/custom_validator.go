@@ -1,6 +1,9 @@
 package main
 
 import (
+	"unicode/utf8"
+
+	"github.com/N0tR1CH/sad/internal/markdown"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -15,6 +18,13 @@ func (cv *CustomValidator) Validate(i any) error {
 	return nil
 }
 
+// NewCustomValidator wraps v and registers the "markdown" tag which
+// limits content rendered as Markdown to markdown.MaxLength characters.
 func NewCustomValidator(v *validator.Validate) *CustomValidator {
+	v.RegisterValidation("markdown", validateMarkdown)
 	return &CustomValidator{validator: v}
 }
+
+func validateMarkdown(fl validator.FieldLevel) bool {
+	return utf8.RuneCountInString(fl.Field().String()) <= markdown.MaxLength
+}
@@ -1,21 +1,25 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/markdown"
+	"github.com/N0tR1CH/sad/internal/services"
 	"github.com/N0tR1CH/sad/views"
 	"github.com/N0tR1CH/sad/views/components"
 	"github.com/N0tR1CH/sad/views/pages"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
-	"github.com/yuin/goldmark"
 )
 
+var errDiscussionNotModifiable = errors.New("discussion can be modified only by its author")
+
 func (app *application) newDiscussionHandler(c echo.Context) error {
 	categories, err := app.models.Categories.GetAll()
 	if err != nil {
@@ -31,6 +35,13 @@ func (app *application) newDiscussionHandler(c echo.Context) error {
 		ResourceUrl: c.QueryParam("url"),
 		Categories:  cps,
 	}
+	// Title of the shared page prefills the form, it is
+	// requested by the form once it is rendered
+	if dfp.ResourceUrl != "" {
+		dfp.SuggestedTitleUrl = "/discussions/new/title?" + url.Values{
+			"url": {dfp.ResourceUrl},
+		}.Encode()
+	}
 
 	if _, HTMX := c.Request().Header[http.CanonicalHeaderKey("HX-Request")]; HTMX {
 		return views.Render(c, http.StatusOK, components.DiscussionForm(dfp))
@@ -45,7 +56,8 @@ func (app *application) getDiscussionsHandler(c echo.Context) error {
 	}
 	app.logger.Info("app#getDiscussionsHandler", "page", page)
 	category := c.QueryParam("category")
-	discussions, err := app.models.Discussions.GetAll(category, page)
+	sort := data.ParseDiscussionSort(c.QueryParam("sort"))
+	discussions, err := app.models.Discussions.GetAll(category, sort, page)
 	if err != nil {
 		app.logger.Error("app#getDiscussionsHandler", "err", err.Error())
 		return c.String(
@@ -78,18 +90,32 @@ func (app *application) getDiscussionsHandler(c echo.Context) error {
 
 	dcvms := make([]components.DiscussionCardViewModel, len(discussions))
 	for i := 0; i < len(discussions); i++ {
+		imgSrc, previewStatus := discussionCardPreview(&discussions[i])
 		dcvms[i] = components.DiscussionCardViewModel{
-			ImgSrc:    discussions[i].PreviewSrc,
-			CardTitle: discussions[i].Title,
-			Id:        discussions[i].ID,
+			ImgSrc:        imgSrc,
+			PreviewStatus: previewStatus,
+			CardTitle:     discussions[i].Title,
+			Id:            discussions[i].ID,
+			NumUpvotes:    discussions[i].NumUpvotes,
+			SiteName:      discussions[i].Metadata.SiteName,
+			FaviconSrc:    discussions[i].Metadata.FaviconUrl,
 		}
 	}
 
 	if c.Get("HTMX").(bool) {
+		nextPageParams := url.Values{}
+		nextPageParams.Set("page", strconv.Itoa(page+1))
+		nextPageParams.Set("sort", string(sort))
+		if category != "" {
+			nextPageParams.Set("category", category)
+		}
 		return views.Render(
 			c,
 			http.StatusOK,
-			components.DiscussionCards(dcvms, page+1, category),
+			components.DiscussionCards(
+				dcvms,
+				"/discussions?"+nextPageParams.Encode(),
+			),
 		)
 	}
 	return c.Redirect(http.StatusTemporaryRedirect, "/")
@@ -134,6 +160,11 @@ func (app *application) getDiscussionHandler(c echo.Context) error {
 		return err
 	}
 
+	canModify, err := app.canModifyDiscussion(c.Get("userID").(int), d)
+	if err != nil {
+		return err
+	}
+
 	dvm := components.DiscussionViewModel{
 		Id:          d.ID,
 		UserId:      d.UserId,
@@ -141,15 +172,15 @@ func (app *application) getDiscussionHandler(c echo.Context) error {
 		ResourceUrl: d.Url,
 		Dtvm: components.DiscussionTopViewModel{
 			Date:     d.CreatedAt.Format(time.ANSIC),
-			ImgSrc:   imgSrc,
+			ImgSrc:   services.AvatarVariant(imgSrc, 64),
 			Username: username,
 		},
+		CanModify:  canModify,
+		NumUpvotes: d.NumUpvotes,
 	}
-	var buf bytes.Buffer
-	if err := goldmark.Convert([]byte(d.Description), &buf); err != nil {
+	if dvm.Description, err = renderMarkdown(d.Description); err != nil {
 		return err
 	}
-	dvm.Description = views.Unsafe(buf.String())
 
 	if c.Get("HTMX").(bool) {
 		return views.Render(
@@ -170,7 +201,7 @@ func (app *application) getDiscussionHandler(c echo.Context) error {
 func (app *application) createDiscussionHandler(c echo.Context) error {
 	var input struct {
 		Title       string `form:"title" validate:"required,max=130"`
-		Description string `form:"description" validate:"required,max=4000"`
+		Description string `form:"description" validate:"required,markdown"`
 		Url         string `form:"url" validate:"required,url"`
 		CategoryId  string `form:"categories" validate:"required,number"`
 	}
@@ -180,61 +211,46 @@ func (app *application) createDiscussionHandler(c echo.Context) error {
 	}
 
 	if err := c.Validate(&input); err != nil {
-		errs := make([]string, 0, len(err.(validator.ValidationErrors)))
-		for _, ve := range err.(validator.ValidationErrors) {
-			switch ve.Tag() {
-			case "required":
-				errs = append(
-					errs,
-					fmt.Sprintf("Field '%s' can't be blank.", ve.Field()),
-				)
-			case "max":
-				errs = append(
-					errs,
-					fmt.Sprintf(
-						"Field '%s' maximum length is %s characters.",
-						ve.Field(),
-						ve.Param(),
-					),
-				)
-			case "number":
-				errs = append(
-					errs,
-					fmt.Sprintf(
-						"Field '%s' must be a number",
-						ve.Field(),
-					),
-				)
-			case "url":
-				errs = append(
-					errs,
-					fmt.Sprintf("Invalid URL format."),
-				)
-			default:
-				errs = append(errs, ve.Error())
-			}
-		}
 		return views.Render(
 			c,
 			http.StatusBadRequest,
-			components.DiscussionFormErrors(errs),
+			components.DiscussionFormErrors(discussionFormErrMsgs(err)),
 		)
 	}
 
-	previewSrc, err := app.services.ChromeDp.GenScreenshot(input.Url)
+	canonicalUrl, err := data.CanonicalizeUrl(input.Url)
 	if err != nil {
+		return views.Render(
+			c,
+			http.StatusBadRequest,
+			components.DiscussionFormErrors([]string{"Invalid URL format."}),
+		)
+	}
+	if err := app.services.UrlGuard.Check(input.Url); err != nil {
+		return views.Render(
+			c,
+			http.StatusBadRequest,
+			components.DiscussionFormErrors([]string{unsafeUrlErrMsg(err)}),
+		)
+	}
+	switch existing, err := app.models.Discussions.GetByCanonicalUrl(canonicalUrl); {
+	case err == nil:
+		return app.redirectToExistingDiscussion(c, existing)
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.logger.Error("app#createDiscussionHandler", "err", err.Error())
 		return views.Render(
 			c,
 			http.StatusBadRequest,
 			components.DiscussionFormErrors([]string{"Problem with the server"}),
 		)
 	}
+
 	d := &data.Discussion{
-		Title:       input.Title,
-		Url:         input.Url,
-		Description: input.Description,
-		PreviewSrc:  previewSrc,
-		UserId:      c.Get("userID").(int),
+		Title:        input.Title,
+		Url:          input.Url,
+		CanonicalUrl: canonicalUrl,
+		Description:  input.Description,
+		UserId:       c.Get("userID").(int),
 	}
 
 	cID, err := strconv.Atoi(input.CategoryId)
@@ -244,6 +260,13 @@ func (app *application) createDiscussionHandler(c echo.Context) error {
 	d.CategoryID = cID
 
 	if err := app.models.Discussions.Insert(d); err != nil {
+		if errors.Is(err, data.ErrDuplicatedUrl) {
+			// Someone shared the same resource in the meantime
+			existing, err := app.models.Discussions.GetByCanonicalUrl(canonicalUrl)
+			if err == nil {
+				return app.redirectToExistingDiscussion(c, existing)
+			}
+		}
 		app.logger.Error("app#createDiscussionHandler", "err", err.Error())
 		return views.Render(
 			c,
@@ -265,6 +288,47 @@ func (app *application) createDiscussionHandler(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+// redirectToExistingDiscussion sends user to the discussion which
+// already shares the resource user tried to submit.
+func (app *application) redirectToExistingDiscussion(
+	c echo.Context,
+	existing *data.Discussion,
+) error {
+	c.Response().Header().Set(
+		"HX-Location",
+		fmt.Sprintf("/discussions/%d", existing.ID),
+	)
+	app.sessionManager.Put(
+		c.Request().Context(),
+		"alert",
+		components.AlertProps{
+			Title: "Already shared!",
+			Text:  "This link has already been shared, join the discussion!",
+			Icon:  components.Info,
+		},
+	)
+	return c.NoContent(http.StatusOK)
+}
+
+// getSuggestedTitleHandler returns title of the shared page as plain
+// text, no content is returned when it could not be found.
+func (app *application) getSuggestedTitleHandler(c echo.Context) error {
+	var input struct {
+		Url string `query:"url" validate:"required,url"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.NoContent(http.StatusNoContent)
+	}
+	meta, err := app.services.Metadata.Fetch(input.Url)
+	if err != nil || meta.Title == "" {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.String(http.StatusOK, services.Truncate(meta.Title, 130))
+}
+
 func (app *application) validateDiscussionTitleHandler(c echo.Context) error {
 	var input struct {
 		Title string `query:"title" validate:"required,max=130"`
@@ -289,7 +353,7 @@ func (app *application) validateDiscussionTitleHandler(c echo.Context) error {
 
 func (app *application) validateDiscussionDescriptionHandler(c echo.Context) error {
 	var input struct {
-		Description string `query:"description" validate:"required,max=4000"`
+		Description string `query:"description" validate:"required,markdown"`
 	}
 	if err := c.Bind(&input); err != nil {
 		return c.String(http.StatusBadRequest, "bad request")
@@ -300,7 +364,7 @@ func (app *application) validateDiscussionDescriptionHandler(c echo.Context) err
 			switch ve.Tag() {
 			case "required":
 				msg = "Field is required"
-			case "max":
+			case "max", "markdown":
 				msg = "Too many characters"
 			}
 		}
@@ -328,13 +392,76 @@ func (app *application) validateDiscussionUrlHandler(c echo.Context) error {
 		}
 		return views.Render(c, http.StatusOK, components.DiscussionFormErrorField(msg))
 	}
+	canonicalUrl, err := data.CanonicalizeUrl(input.Description)
+	if err != nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			components.DiscussionFormErrorField("Field must be url"),
+		)
+	}
+	if err := app.services.UrlGuard.Check(input.Description); err != nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			components.DiscussionFormErrorField(unsafeUrlErrMsg(err)),
+		)
+	}
+	if _, err := app.models.Discussions.GetByCanonicalUrl(canonicalUrl); err == nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			components.DiscussionFormErrorField("This link has already been shared"),
+		)
+	}
 	return c.String(http.StatusOK, "")
 }
 
+// unsafeUrlErrMsg explains to the user why the url was rejected.
+func unsafeUrlErrMsg(err error) string {
+	var unsafeErr *services.UnsafeUrlError
+	if errors.As(err, &unsafeErr) {
+		return fmt.Sprintf("This link can't be shared: %s.", unsafeErr.Reason)
+	}
+	return "This link can't be shared."
+}
+
+func (app *application) upvoteDiscussionHandler(c echo.Context) error {
+	var input struct {
+		DiscussionId string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return fmt.Errorf("in app#upvoteDiscussionHandler: %w", err)
+	}
+	if err := c.Validate(&input); err != nil {
+		return fmt.Errorf("in app#upvoteDiscussionHandler: %w", err)
+	}
+	dId, err := strconv.Atoi(input.DiscussionId)
+	if err != nil {
+		return fmt.Errorf("in app#upvoteDiscussionHandler: %w", err)
+	}
+	var userId int
+	if uId, ok := c.Get("userID").(int); !ok || uId == 0 {
+		return errors.New("userID should be in the request context")
+	} else {
+		userId = uId
+	}
+	if err := app.models.Discussions.Upvote(userId, dId); err != nil {
+		if errors.Is(err, data.ErrUniquenessViolation) {
+			return c.NoContent(http.StatusConflict)
+		}
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return fmt.Errorf("in app#upvoteDiscussionHandler: %w", err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
 func (app *application) genDiscussionPreview(c echo.Context) error {
 	var input struct {
 		Title       string `query:"title" validate:"required,max=130"`
-		Description string `query:"description" validate:"required,max=4000"`
+		Description string `query:"description" validate:"required,markdown"`
 		Url         string `query:"url" validate:"required,url"`
 	}
 
@@ -360,6 +487,15 @@ func (app *application) genDiscussionPreview(c echo.Context) error {
 						ve.Param(),
 					),
 				)
+			case "markdown":
+				errs = append(
+					errs,
+					fmt.Sprintf(
+						"Field '%s' maximum length is %d characters.",
+						ve.Field(),
+						markdown.MaxLength,
+					),
+				)
 			default:
 				errs = append(errs, ve.Error())
 			}
@@ -367,20 +503,287 @@ func (app *application) genDiscussionPreview(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Wrong params!")
 	}
 
-	resPath, err := app.services.ChromeDp.GenScreenshot(input.Url)
-	if err != nil {
-		return c.String(http.StatusBadRequest, "Couldn't generate preview")
-	}
-
+	// Screenshot is generated in the background once discussion
+	// is created, so preview only shows the placeholder in its place.
 	return views.Render(
 		c,
 		http.StatusOK,
 		components.DiscussionCard(
 			components.DiscussionCardViewModel{
-				CardTitle: input.Title,
-				ImgSrc:    resPath,
+				CardTitle:     input.Title,
+				PreviewStatus: string(data.PreviewPending),
 			},
 			true,
 		),
 	)
 }
+
+// discussionFormErrMsgs translates validation errors of discussion
+// form into messages displayed to the user.
+func discussionFormErrMsgs(err error) []string {
+	ves, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return []string{"Problem with the server"}
+	}
+	errs := make([]string, 0, len(ves))
+	for _, ve := range ves {
+		switch ve.Tag() {
+		case "required":
+			errs = append(
+				errs,
+				fmt.Sprintf("Field '%s' can't be blank.", ve.Field()),
+			)
+		case "max":
+			errs = append(
+				errs,
+				fmt.Sprintf(
+					"Field '%s' maximum length is %s characters.",
+					ve.Field(),
+					ve.Param(),
+				),
+			)
+		case "markdown":
+			errs = append(
+				errs,
+				fmt.Sprintf(
+					"Field '%s' maximum length is %d characters.",
+					ve.Field(),
+					markdown.MaxLength,
+				),
+			)
+		case "number":
+			errs = append(
+				errs,
+				fmt.Sprintf(
+					"Field '%s' must be a number",
+					ve.Field(),
+				),
+			)
+		case "url":
+			errs = append(errs, "Invalid URL format.")
+		default:
+			errs = append(errs, ve.Error())
+		}
+	}
+	return errs
+}
+
+// canModifyDiscussion reports whether user can edit or delete the discussion.
+//
+// Only author of the discussion and admins are allowed to do that.
+// Discussions created by guests can be modified by admins only.
+func (app *application) canModifyDiscussion(userID int, d *data.Discussion) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+	if d.UserId == userID {
+		return true, nil
+	}
+	admin, err := app.models.Users.HasRole(userID, "admin")
+	if err != nil {
+		return false, fmt.Errorf("in app#canModifyDiscussion: %w", err)
+	}
+	return admin, nil
+}
+
+// discussionForModification retrieves discussion from the path params
+// and checks whether current user is allowed to modify it.
+func (app *application) discussionForModification(c echo.Context) (*data.Discussion, error) {
+	var input struct {
+		Id string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(&input); err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+	discussionId, err := strconv.Atoi(input.Id)
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+	d, err := app.models.Discussions.Get(int64(discussionId))
+	if err != nil {
+		return nil, err
+	}
+	canModify, err := app.canModifyDiscussion(c.Get("userID").(int), d)
+	if err != nil {
+		return nil, err
+	}
+	if !canModify {
+		return nil, errDiscussionNotModifiable
+	}
+	return d, nil
+}
+
+func (app *application) discussionModificationFailed(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.sessionManager.Put(
+			c.Request().Context(),
+			"alert",
+			components.AlertProps{
+				Title: "No discussion!",
+				Text:  "Sorry but this discussion does not exist",
+				Icon:  components.Warning,
+			},
+		)
+	case errors.Is(err, errDiscussionNotModifiable):
+		app.sessionManager.Put(
+			c.Request().Context(),
+			"alert",
+			components.AlertProps{
+				Title: "Not Authorized",
+				Text:  "Only author of the discussion can modify it!",
+				Icon:  components.Error,
+			},
+		)
+	default:
+		return err
+	}
+	if c.Get("HTMX").(bool) {
+		c.Response().Header().Set("HX-Location", "/")
+		return c.NoContent(http.StatusOK)
+	}
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+func (app *application) editDiscussionHandler(c echo.Context) error {
+	d, err := app.discussionForModification(c)
+	if err != nil {
+		return app.discussionModificationFailed(c, err)
+	}
+	categories, err := app.models.Categories.GetAll()
+	if err != nil {
+		return err
+	}
+	cps := make(components.CategoriesProps, len(categories))
+	for i := range cps {
+		cps[i].ID = categories[i].ID
+		cps[i].Name = categories[i].Name
+	}
+	edfvm := components.EditDiscussionFormViewModel{
+		Id:          d.ID,
+		Version:     d.Version,
+		Title:       d.Title,
+		Description: d.Description,
+		CategoryId:  d.CategoryID,
+		Categories:  cps,
+	}
+	if c.Get("HTMX").(bool) && !c.Get("Boosted").(bool) {
+		return views.Render(c, http.StatusOK, components.EditDiscussionForm(edfvm))
+	}
+	return views.Render(c, http.StatusOK, pages.EditDiscussionPage(edfvm))
+}
+
+func (app *application) updateDiscussionHandler(c echo.Context) error {
+	d, err := app.discussionForModification(c)
+	if err != nil {
+		return app.discussionModificationFailed(c, err)
+	}
+
+	var input struct {
+		Title       string `form:"title" validate:"required,max=130"`
+		Description string `form:"description" validate:"required,markdown"`
+		CategoryId  string `form:"categories" validate:"required,number"`
+		Version     string `form:"version" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	if err := c.Validate(&input); err != nil {
+		return views.Render(
+			c,
+			http.StatusBadRequest,
+			components.DiscussionFormErrors(discussionFormErrMsgs(err)),
+		)
+	}
+
+	cID, err := strconv.Atoi(input.CategoryId)
+	if err != nil {
+		return fmt.Errorf("in app#updateDiscussionHandler: %w", err)
+	}
+	version, err := strconv.Atoi(input.Version)
+	if err != nil {
+		return fmt.Errorf("in app#updateDiscussionHandler: %w", err)
+	}
+
+	d.Title = input.Title
+	d.Description = input.Description
+	d.CategoryID = cID
+	d.Version = version
+	if err := app.models.Discussions.Update(d); err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			return views.Render(
+				c,
+				http.StatusConflict,
+				components.DiscussionFormErrors(
+					[]string{
+						"Discussion has been modified in the meantime. Reload the page and try again.",
+					},
+				),
+			)
+		}
+		app.logger.Error("app#updateDiscussionHandler", "err", err.Error())
+		return views.Render(
+			c,
+			http.StatusBadRequest,
+			components.DiscussionFormErrors([]string{"Problem with the server"}),
+		)
+	}
+
+	c.Response().Header().Set("HX-Location", fmt.Sprintf("/discussions/%d", d.ID))
+	app.sessionManager.Put(
+		c.Request().Context(),
+		"alert",
+		components.AlertProps{
+			Title: "Discussion updated!",
+			Text:  "You have successfully updated the discussion!",
+			Icon:  components.Success,
+		},
+	)
+	return c.NoContent(http.StatusOK)
+}
+
+func (app *application) deleteDiscussionHandler(c echo.Context) error {
+	d, err := app.discussionForModification(c)
+	if err != nil {
+		return app.discussionModificationFailed(c, err)
+	}
+	if err := app.models.Discussions.Delete(int64(d.ID)); err != nil {
+		return app.discussionModificationFailed(
+			c,
+			fmt.Errorf("in app#deleteDiscussionHandler: %w", err),
+		)
+	}
+
+	app.startBackgroundJob(func() {
+		if err := app.services.ChromeDp.RemoveScreenshot(d.PreviewSrc); err != nil {
+			app.logger.Error(
+				"app#deleteDiscussionHandler while removing preview",
+				"err", err.Error(),
+			)
+		}
+		if err := app.services.Metadata.RemoveImages(
+			d.Metadata.ImageUrl,
+			d.Metadata.FaviconUrl,
+		); err != nil {
+			app.logger.Error(
+				"app#deleteDiscussionHandler while removing metadata images",
+				"err", err.Error(),
+			)
+		}
+	})
+
+	c.Response().Header().Set("HX-Location", "/")
+	app.sessionManager.Put(
+		c.Request().Context(),
+		"alert",
+		components.AlertProps{
+			Title: "Discussion deleted!",
+			Text:  "You have successfully deleted the discussion!",
+			Icon:  components.Success,
+		},
+	)
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/mailer"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) editUserEmailHandler(c echo.Context) error {
+	var input struct {
+		ID string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return err
+	}
+	uID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return err
+	}
+	if uID != c.Get("userID").(int) {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return views.Render(
+		c,
+		http.StatusOK,
+		pages.ChangeEmailForm(pages.ChangeEmailFormViewModel{Id: uID}),
+	)
+}
+
+// updateUserEmailHandler does not change the email right away, the new
+// address is stored as pending and a confirmation link is mailed to it.
+func (app *application) updateUserEmailHandler(c echo.Context) error {
+	var input struct {
+		ID       string `param:"id" validate:"required,number"`
+		Email    string `form:"email" validate:"required,email,max=255"`
+		Password string `form:"password" validate:"required,max=64"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	uID, err := strconv.Atoi(input.ID)
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if uID != c.Get("userID").(int) {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	formErr := func(msg string) error {
+		return views.Render(
+			c,
+			http.StatusBadRequest,
+			pages.ChangeEmailForm(
+				pages.ChangeEmailFormViewModel{Id: uID, Email: input.Email, ErrMsg: msg},
+			),
+		)
+	}
+	if err := c.Validate(&input); err != nil {
+		return formErr("Provide valid email and your current password.")
+	}
+
+	email, err := app.models.Users.GetEmail(uID)
+	if err != nil {
+		return fmt.Errorf("in app#updateUserEmailHandler: %w", err)
+	}
+	u, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		return fmt.Errorf("in app#updateUserEmailHandler: %w", err)
+	}
+	match, err := u.Password.Match(input.Password)
+	if err != nil {
+		return fmt.Errorf("in app#updateUserEmailHandler: %w", err)
+	}
+	if !match {
+		return formErr("Password is not right.")
+	}
+	if strings.EqualFold(u.Email, input.Email) {
+		return formErr("This is already your email.")
+	}
+
+	if err := app.models.Users.SetPendingEmail(uID, input.Email); err != nil {
+		if errors.Is(err, data.ErrDuplicatedEmail) {
+			return formErr("Email is already used by another account.")
+		}
+		return fmt.Errorf("in app#updateUserEmailHandler: %w", err)
+	}
+	// Only the most recently sent link is valid
+	if err := app.models.Tokens.DeleteAllForUser(data.TokenTypeEmailChange, uID); err != nil {
+		return fmt.Errorf("in app#updateUserEmailHandler: %w", err)
+	}
+	t, err := app.models.Tokens.New(uID, 24*time.Hour, data.TokenTypeEmailChange)
+	if err != nil {
+		return fmt.Errorf("in app#updateUserEmailHandler: %w", err)
+	}
+
+	app.startBackgroundJob(func() {
+		if err := app.mailer.Send(
+			input.Email,
+			mailer.EmailChangeSubject(),
+			mailer.EmailChangePlainBody(t.PlainText),
+			mailer.EmailChangeHtmlBody(t.PlainText),
+		); err != nil {
+			app.logger.Error(
+				"app#updateUserEmailHandler while sending email",
+				"err", err.Error(),
+			)
+		}
+	})
+
+	return views.Render(c, http.StatusOK, pages.ChangeEmailSent(input.Email))
+}
+
+func (app *application) confirmEmailPageHandler(c echo.Context) error {
+	var input struct {
+		Token string `query:"token" validate:"required,len=26,alphanum"`
+	}
+	if err := c.Bind(&input); err != nil {
+		app.logger.Error("app#confirmEmailPageHandler", "err", err.Error())
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.String(
+			http.StatusBadRequest,
+			"Link is malformed, please visit link from the email again.",
+		)
+	}
+	return views.Render(c, http.StatusOK, pages.ConfirmEmailPage(input.Token))
+}
+
+// confirmEmailHandler applies the pending email and lets
+// the previous address know about the change.
+func (app *application) confirmEmailHandler(c echo.Context) error {
+	var input struct {
+		Token string `form:"token" validate:"required,len=26,alphanum"`
+	}
+	if err := c.Bind(&input); err != nil {
+		app.logger.Error("app#confirmEmailHandler", "err", err.Error())
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ConfirmEmailResult("Values could not be binded to the request!", false),
+		)
+	}
+	if err := c.Validate(&input); err != nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ConfirmEmailResult("Values could not be validated.", false),
+		)
+	}
+
+	u, err := app.models.Users.GetForToken(data.TokenTypeEmailChange, input.Token)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("app#confirmEmailHandler", "err", err.Error())
+			return err
+		}
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ConfirmEmailResult("Link is invalid or has expired.", false),
+		)
+	}
+
+	oldEmail, newEmail, err := app.models.Users.ConfirmEmail(u.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatedEmail):
+			return views.Render(
+				c,
+				http.StatusOK,
+				pages.ConfirmEmailResult(
+					"Email has been taken by another account in the meantime.",
+					false,
+				),
+			)
+		case errors.Is(err, data.ErrRecordNotFound):
+			return views.Render(
+				c,
+				http.StatusOK,
+				pages.ConfirmEmailResult("There is no email change to confirm.", false),
+			)
+		default:
+			app.logger.Error("app#confirmEmailHandler", "err", err.Error())
+			return err
+		}
+	}
+	if err := app.models.Tokens.DeleteAllForUser(data.TokenTypeEmailChange, u.ID); err != nil {
+		app.logger.Error("app#confirmEmailHandler", "err", err.Error())
+		return err
+	}
+
+	app.startBackgroundJob(func() {
+		if err := app.mailer.Send(
+			oldEmail,
+			mailer.EmailChangedSubject(),
+			mailer.EmailChangedPlainBody(),
+			mailer.EmailChangedHtmlBody(),
+		); err != nil {
+			app.logger.Error(
+				"app#confirmEmailHandler while sending email",
+				"err", err.Error(),
+			)
+		}
+	})
+
+	return views.Render(
+		c,
+		http.StatusOK,
+		pages.ConfirmEmailResult(
+			fmt.Sprintf("Your email is now %s.", newEmail),
+			true,
+		),
+	)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// hotScoreRefreshInterval is how often hot scores of discussions are
+// recomputed. Hot pages stay the same in between, so paging through
+// them does not skip nor repeat discussions.
+const hotScoreRefreshInterval = 5 * time.Minute
+
+// startHotScoreRefresher launches worker refreshing hot scores of
+// discussions. It stops once ctx is done and is tracked by the wait
+// group like the preview workers.
+func (app *application) startHotScoreRefresher(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		for {
+			if _, err := app.models.Discussions.RefreshHotScores(); err != nil {
+				app.logger.Error("app#startHotScoreRefresher", "err", err.Error())
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(hotScoreRefreshInterval):
+			}
+		}
+	}()
+	app.logger.Info("hot score refresher started")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/mailer"
+)
+
+const (
+	// loginFailureWindow is the period in which failed attempts
+	// are counted, older ones are forgotten.
+	loginFailureWindow = time.Hour
+	// Failures after which each next attempt has to wait twice as
+	// long as the previous one, up to maxLoginBackoff.
+	accountBackoffAfter = 3
+	ipBackoffAfter      = 10
+	maxLoginBackoff     = 15 * time.Minute
+	// accountLockoutAfter failures lock the account and its owner
+	// is notified by email.
+	accountLockoutAfter    = 10
+	accountLockoutDuration = 30 * time.Minute
+)
+
+// loginBackoff returns time left until the next attempt
+// is allowed after the given failures.
+func loginBackoff(f *data.LoginFailures, after int) time.Duration {
+	if f.Count < after {
+		return 0
+	}
+	exp := math.Min(float64(f.Count-after), 20)
+	backoff := time.Duration(math.Pow(2, exp)) * time.Second
+	if backoff > maxLoginBackoff {
+		backoff = maxLoginBackoff
+	}
+	return time.Until(f.Last.Add(backoff))
+}
+
+// loginWait returns time for which login attempts with the email
+// or from the ip address are refused, both are limited separately.
+func (app *application) loginWait(email, ip string) (time.Duration, error) {
+	accountFailures, err := app.models.LoginAttempts.FailuresForEmail(email, loginFailureWindow)
+	if err != nil {
+		return 0, fmt.Errorf("in app#loginWait: %w", err)
+	}
+	ipFailures, err := app.models.LoginAttempts.FailuresForIP(ip, loginFailureWindow)
+	if err != nil {
+		return 0, fmt.Errorf("in app#loginWait: %w", err)
+	}
+	return max(
+		loginBackoff(accountFailures, accountBackoffAfter),
+		loginBackoff(ipFailures, ipBackoffAfter),
+	), nil
+}
+
+// recordLoginAttempt stores the attempt in the audit log. Failing to
+// do so is only logged, it must not prevent users from logging in.
+func (app *application) recordLoginAttempt(a data.LoginAttempt) {
+	if err := app.models.LoginAttempts.Insert(&a); err != nil {
+		app.logger.Error("app#recordLoginAttempt", "err", err.Error())
+	}
+}
+
+// lockAccountIfNeeded locks the account after too many failed
+// attempts and lets the owner know about it.
+func (app *application) lockAccountIfNeeded(u *data.User) error {
+	f, err := app.models.LoginAttempts.FailuresForEmail(u.Email, loginFailureWindow)
+	if err != nil {
+		return fmt.Errorf("in app#lockAccountIfNeeded: %w", err)
+	}
+	if f.Count < accountLockoutAfter {
+		return nil
+	}
+	until := time.Now().Add(accountLockoutDuration)
+	locked, err := app.models.Users.Lock(u.ID, until)
+	if err != nil {
+		return fmt.Errorf("in app#lockAccountIfNeeded: %w", err)
+	}
+	if !locked {
+		return nil
+	}
+	app.logger.Warn("app#lockAccountIfNeeded", "userID", u.ID, "failures", f.Count)
+	lockedUntil := until.UTC().Format("2006-01-02 15:04 MST")
+	app.startBackgroundJob(func() {
+		if err := app.mailer.Send(
+			u.Email,
+			mailer.AccountLockedSubject(),
+			mailer.AccountLockedPlainBody(lockedUntil),
+			mailer.AccountLockedHtmlBody(lockedUntil),
+		); err != nil {
+			app.logger.Error(
+				"app#lockAccountIfNeeded while sending email",
+				"err", err.Error(),
+			)
+		}
+	})
+	return nil
+}
+
+// waitMsg formats the wait rounded up to whole minutes or seconds.
+func waitMsg(wait time.Duration) string {
+	if wait >= time.Minute {
+		return fmt.Sprintf("%d minute(s)", int(math.Ceil(wait.Minutes())))
+	}
+	return fmt.Sprintf("%d second(s)", int(math.Ceil(wait.Seconds())))
+}
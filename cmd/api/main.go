@@ -8,15 +8,18 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/N0tR1CH/sad/internal/data"
 	"github.com/N0tR1CH/sad/internal/mailer"
 	"github.com/N0tR1CH/sad/internal/services"
+	"github.com/N0tR1CH/sad/internal/storage"
 	"github.com/N0tR1CH/sad/views/components"
 	"github.com/alexedwards/scs/pgxstore"
 	"github.com/alexedwards/scs/v2"
@@ -27,6 +30,10 @@ import (
 
 func init() {
 	gob.Register(components.AlertProps{})
+	// Sessions are gob encoded, values stored as interfaces
+	// need their concrete types registered
+	gob.Register(time.Time{})
+	gob.Register(sessionInfo{})
 }
 
 const version = "1.0.0"
@@ -37,15 +44,28 @@ const (
 )
 
 type config struct {
-	port    int
-	env     string
-	useOsFs bool
-	db      struct {
+	port           int
+	env            string
+	baseURL        string
+	useOsFs        bool
+	previewWorkers int
+	chromeMaxTabs  int
+	trustedProxies []*net.IPNet
+	comments       struct {
+		editWindow         time.Duration
+		downvoteReputation int
+	}
+	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
 	}
+	storage struct {
+		driver string
+		dir    string
+		s3     storage.S3Config
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -63,6 +83,7 @@ type application struct {
 	services       services.Services
 	sessionManager *scs.SessionManager
 	mailer         mailer.Mailer
+	storage        storage.Storage
 	wg             sync.WaitGroup
 }
 
@@ -72,6 +93,14 @@ func newConfig(logger *slog.Logger) *config {
 	// Port on which server starts
 	flag.IntVar(&cfg.port, "port", 4000, "WEBAPP server port")
 
+	// Url the site is reached under, links in emails are built from it
+	flag.StringVar(
+		&cfg.baseURL,
+		"base-url",
+		"https://localhost:4000",
+		"Public url of the site",
+	)
+
 	// Environment type
 	//
 	// Cors configuration depend on it
@@ -92,6 +121,56 @@ func newConfig(logger *slog.Logger) *config {
 		"Choose between embed fs or live fs",
 	)
 
+	// Number of workers generating discussion previews
+	flag.IntVar(
+		&cfg.previewWorkers,
+		"preview-workers",
+		2,
+		"Number of workers generating discussion previews",
+	)
+
+	// Number of browser tabs taking screenshots at once
+	flag.IntVar(
+		&cfg.chromeMaxTabs,
+		"chrome-max-tabs",
+		4,
+		"Maximum number of concurrently opened headless browser tabs",
+	)
+
+	// Reverse proxies whose X-Forwarded-For header is trusted
+	//
+	// Without them client ip is the address of the connection
+	flag.Func(
+		"trusted-proxies",
+		"Comma separated CIDR ranges of reverse proxies, e.g. 172.16.0.0/12",
+		func(s string) error {
+			for _, cidr := range strings.Split(s, ",") {
+				_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+				if err != nil {
+					return err
+				}
+				cfg.trustedProxies = append(cfg.trustedProxies, ipNet)
+			}
+			return nil
+		},
+	)
+
+	// Time after posting during which authors can edit their comments
+	flag.DurationVar(
+		&cfg.comments.editWindow,
+		"comment-edit-window",
+		15*time.Minute,
+		"Time after posting during which comments can be edited",
+	)
+
+	// Reputation users need to downvote comments
+	flag.IntVar(
+		&cfg.comments.downvoteReputation,
+		"downvote-min-reputation",
+		10,
+		"Reputation needed to downvote comments",
+	)
+
 	// Database configuration
 	flag.StringVar(
 		&cfg.db.dsn,
@@ -118,6 +197,32 @@ func newConfig(logger *slog.Logger) *config {
 		"PostgreSQL max connection idle time",
 	)
 
+	// Storage of previews and avatars
+	flag.StringVar(
+		&cfg.storage.driver,
+		"storage-driver",
+		"local",
+		"Storage of uploaded and generated images (local|s3)",
+	)
+	flag.StringVar(
+		&cfg.storage.dir,
+		"storage-dir",
+		"cmd/web/public",
+		"Directory of the local storage, served under /public",
+	)
+	flag.StringVar(&cfg.storage.s3.Endpoint, "s3-endpoint", "localhost:9000", "S3 endpoint")
+	flag.StringVar(&cfg.storage.s3.Region, "s3-region", "", "S3 region")
+	flag.StringVar(&cfg.storage.s3.Bucket, "s3-bucket", "sad", "S3 bucket")
+	flag.StringVar(&cfg.storage.s3.AccessKey, "s3-access-key", "", "S3 access key")
+	flag.StringVar(&cfg.storage.s3.SecretKey, "s3-secret-key", "", "S3 secret key")
+	flag.BoolVar(&cfg.storage.s3.UseSSL, "s3-use-ssl", false, "Connect to S3 over TLS")
+	flag.StringVar(
+		&cfg.storage.s3.PublicUrl,
+		"s3-public-url",
+		"",
+		"Url under which objects are served, defaults to the bucket url",
+	)
+
 	// Mailer configuration
 	flag.StringVar(
 		&cfg.smtp.host,
@@ -176,6 +281,7 @@ func newApplication(
 	services services.Services,
 	sessionManager *scs.SessionManager,
 	mailer mailer.Mailer,
+	storage storage.Storage,
 ) *application {
 	return &application{
 		config:         cfg,
@@ -184,6 +290,7 @@ func newApplication(
 		services:       services,
 		sessionManager: sessionManager,
 		mailer:         mailer,
+		storage:        storage,
 		wg:             sync.WaitGroup{},
 	}
 }
@@ -229,9 +336,13 @@ func newServer(port int, env string, handler http.Handler) *http.Server {
 	return s
 }
 
-func newSessionManager(pool *pgxpool.Pool) *scs.SessionManager {
+func newSessionManager(pool *pgxpool.Pool, models data.Models) *scs.SessionManager {
 	sm := scs.New()
-	sm.Store = pgxstore.New(pool)
+	sm.Store = userSessionStore{
+		PostgresStore: pgxstore.New(pool),
+		codec:         sm.Codec,
+		models:        models,
+	}
 	sm.Lifetime = 12 * time.Hour
 	return sm
 }
@@ -268,23 +379,47 @@ func main() {
 		fmt.Sprintf("%+v", pool.Stat()),
 	)
 
+	store, err := newStorage(cfg)
+	if err != nil {
+		logger.Error("storage problem", "err", err)
+		os.Exit(exitFailure)
+	}
+
+	// Headless browser shared by screenshots
+	svcs := services.NewServices(logger, cfg.chromeMaxTabs, store)
+	defer svcs.ChromeDp.Close()
+
+	models := data.NewModels(db, logger)
 	newApplication(
 		cfg,
 		logger,
-		data.NewModels(db, logger),
-		services.NewServices(logger),
-		newSessionManager(pool),
+		models,
+		svcs,
+		newSessionManager(pool, models),
 		mailer.New(
 			cfg.smtp.host,
 			cfg.smtp.port,
 			cfg.smtp.username,
 			cfg.smtp.password,
 			cfg.smtp.sender,
+			cfg.baseURL,
 			cfg.env,
 		),
+		store,
 	).serve()
 }
 
+func newStorage(cfg *config) (storage.Storage, error) {
+	switch cfg.storage.driver {
+	case "local":
+		return storage.NewLocal(cfg.storage.dir, "/public"), nil
+	case "s3":
+		return storage.NewS3(cfg.storage.s3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.storage.driver)
+	}
+}
+
 func openDB(cfg *config) (*sql.DB, error) {
 	db, err := sql.Open("pgx", cfg.db.dsn)
 	if err != nil {
@@ -320,6 +455,11 @@ func (app *application) serve() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
+	app.startPreviewWorkers(ctx, app.config.previewWorkers)
+	app.startAccountDataWorker(ctx)
+	app.startHotScoreRefresher(ctx)
+	app.startCanonicalUrlBackfill(ctx)
+	app.startMetadataImageBackfill(ctx)
 	go func() {
 		switch app.config.env {
 		case "development":
@@ -349,7 +489,7 @@ func (app *application) serve() {
 	// shutdown the server with a timeout of 10 seconds.
 	<-ctx.Done()
 
-	// Wait for background job to be finished
+	// Wait for background jobs and preview workers to be finished
 	app.wg.Wait()
 
 	app.logger.Info("Server Timeout", "Info", "Killing server in 10 seconds")
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/N0tR1CH/sad/internal/markdown"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/components"
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+)
+
+// renderMarkdown renders content written by users, discussion
+// descriptions and comments alike.
+func renderMarkdown(src string) (templ.Component, error) {
+	html, err := markdown.Render(src)
+	if err != nil {
+		return nil, err
+	}
+	return views.Unsafe(html), nil
+}
+
+// previewMarkdownHandler renders content of the editor the same
+// way it is going to be shown once posted.
+func (app *application) previewMarkdownHandler(c echo.Context) error {
+	var input struct {
+		Content string `form:"content" validate:"markdown"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	if err := c.Validate(&input); err != nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			components.MarkdownPreview(
+				nil,
+				fmt.Sprintf("Maximum length is %d characters.", markdown.MaxLength),
+			),
+		)
+	}
+	content, err := renderMarkdown(input.Content)
+	if err != nil {
+		return fmt.Errorf("in app#previewMarkdownHandler: %w", err)
+	}
+	return views.Render(c, http.StatusOK, components.MarkdownPreview(content, ""))
+}
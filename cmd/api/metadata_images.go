@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/services"
+)
+
+// metadataImageBackfillBatch is the number of discussions
+// read at once by the backfill.
+const metadataImageBackfillBatch = 100
+
+// startMetadataImageBackfill copies images of pages shared before
+// they were stored into the storage, so viewers do not load them from
+// third parties. Images which can not be copied are cleared, the same
+// as for pages shared now. It stops once ctx is done and is tracked by
+// the wait group.
+func (app *application) startMetadataImageBackfill(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		n, err := app.backfillMetadataImages(ctx)
+		if err != nil {
+			app.logger.Error("app#startMetadataImageBackfill", "err", err.Error())
+		}
+		if n > 0 {
+			app.logger.Info("metadata images of discussions stored", "count", n)
+		}
+	}()
+}
+
+func (app *application) backfillMetadataImages(ctx context.Context) (int, error) {
+	storedPrefix := app.storage.URL("metadata/")
+	var afterId, n int
+	for ctx.Err() == nil {
+		images, err := app.models.Discussions.WithRemoteImages(
+			storedPrefix,
+			afterId,
+			metadataImageBackfillBatch,
+		)
+		if err != nil {
+			return n, fmt.Errorf("in app#backfillMetadataImages: %w", err)
+		}
+		if len(images) == 0 {
+			return n, nil
+		}
+		for _, di := range images {
+			afterId = di.ID
+			if ctx.Err() != nil {
+				return n, nil
+			}
+			stored := app.storeRemoteImages(di)
+			err := app.models.Discussions.ReplaceImages(di, stored)
+			if err != nil {
+				_ = app.services.Metadata.RemoveImages(
+					changedImages(di, stored)...,
+				)
+			}
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				// Metadata was fetched again or the
+				// discussion was deleted in the meantime
+			case err != nil:
+				return n, fmt.Errorf("in app#backfillMetadataImages: %w", err)
+			default:
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// storeRemoteImages copies images of the discussion which are
+// not in the storage yet, the stored ones are kept as they are.
+func (app *application) storeRemoteImages(di data.DiscussionImages) data.DiscussionImages {
+	var remote services.PageMetadata
+	if _, ok := app.storage.Key(di.ImageUrl); !ok {
+		remote.ImageUrl = di.ImageUrl
+	}
+	if _, ok := app.storage.Key(di.FaviconUrl); !ok {
+		remote.FaviconUrl = di.FaviconUrl
+	}
+	app.services.Metadata.StoreImages(&remote)
+	stored := di
+	if _, ok := app.storage.Key(di.ImageUrl); !ok {
+		stored.ImageUrl = remote.ImageUrl
+	}
+	if _, ok := app.storage.Key(di.FaviconUrl); !ok {
+		stored.FaviconUrl = remote.FaviconUrl
+	}
+	return stored
+}
+
+// changedImages returns copies made for stored which
+// were not referenced by the discussion before.
+func changedImages(old, stored data.DiscussionImages) []string {
+	var srcs []string
+	if stored.ImageUrl != old.ImageUrl {
+		srcs = append(srcs, stored.ImageUrl)
+	}
+	if stored.FaviconUrl != old.FaviconUrl {
+		srcs = append(srcs, stored.FaviconUrl)
+	}
+	return srcs
+}
@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/N0tR1CH/sad/internal/data"
 	"github.com/N0tR1CH/sad/rate_limiter"
 	"github.com/N0tR1CH/sad/views"
 	"github.com/N0tR1CH/sad/views/components"
@@ -96,6 +99,16 @@ var (
 		}
 	}
 
+	// Requests authenticated with the bearer token are not exposed
+	// to CSRF, browsers never attach the Authorization header on
+	// their own the way they attach cookies.
+	csrfConfig = middleware.CSRFConfig{
+		Skipper: func(c echo.Context) bool {
+			_, ok := bearerToken(c)
+			return ok
+		},
+	}
+
 	rateLimiterConfig = func(env string) rate_limiter.Config {
 		client := redis.NewClient(&redis.Options{
 			Addr: func() string {
@@ -113,6 +126,14 @@ var (
 			Burst:     200,
 			Period:    10 * time.Second,
 			Algorithm: rate_limiter.SlidingWindowAlgorithm,
+			Handler: func(c echo.Context) error {
+				status := rate_limiter.DefaultConfig.StatusCode
+				msg := rate_limiter.DefaultConfig.Message
+				if isAPIRequest(c) {
+					return apiError(c, status, msg)
+				}
+				return c.String(status, msg)
+			},
 		}
 	}
 )
@@ -129,6 +150,75 @@ func (app *application) userIdExtraction(next echo.HandlerFunc) echo.HandlerFunc
 	}
 }
 
+// bearerToken returns personal access token sent
+// in the Authorization header, if there is one.
+func bearerToken(c echo.Context) (string, bool) {
+	token, ok := strings.CutPrefix(
+		c.Request().Header.Get(echo.HeaderAuthorization),
+		"Bearer ",
+	)
+	return strings.TrimSpace(token), ok
+}
+
+// authenticateBearer lets scripts use personal access tokens instead
+// of the session cookie. User of the token replaces the one from the
+// session, so permissions of the role are checked as usual.
+func (app *application) authenticateBearer(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		plainText, ok := bearerToken(c)
+		if !ok {
+			return next(c)
+		}
+		unauthorized := func() error {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="sad"`)
+			if isAPIRequest(c) {
+				return apiError(c, http.StatusUnauthorized, "token is invalid or expired")
+			}
+			return c.String(http.StatusUnauthorized, "token is invalid or expired")
+		}
+		if len(plainText) != 26 {
+			return unauthorized()
+		}
+		u, err := app.models.Users.GetForToken(data.TokenTypeAuthentication, plainText)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return unauthorized()
+			}
+			return fmt.Errorf("in app#authenticateBearer: %w", err)
+		}
+		scopes, err := app.models.Tokens.UsePersonal(plainText)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return unauthorized()
+			}
+			return fmt.Errorf("in app#authenticateBearer: %w", err)
+		}
+
+		scope := data.ScopeWrite
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			scope = data.ScopeRead
+		}
+		if !scopes.Has(scope) {
+			msg := fmt.Sprintf("token is missing %s scope", scope)
+			if isAPIRequest(c) {
+				return apiError(c, http.StatusForbidden, msg)
+			}
+			return c.String(http.StatusForbidden, msg)
+		}
+		c.Set("userID", u.ID)
+		c.Set("tokenScopes", scopes)
+		return next(c)
+	}
+}
+
+// tokenAuthenticated reports whether the request was
+// authenticated with personal access token.
+func tokenAuthenticated(c echo.Context) bool {
+	_, ok := c.Get("tokenScopes").(data.TokenScopes)
+	return ok
+}
+
 func (app *application) authorize(next echo.HandlerFunc) echo.HandlerFunc {
 	sessMan := app.sessionManager
 	logger := app.logger
@@ -148,6 +238,8 @@ func (app *application) authorize(next echo.HandlerFunc) echo.HandlerFunc {
 			switch {
 			case err != nil:
 				return fmt.Errorf("in app#authorize: %w", err)
+			case banned && isAPIRequest(c):
+				return apiError(c, http.StatusForbidden, "You are banned.")
 			case banned:
 				sessMan.Put(
 					c.Request().Context(),
@@ -184,6 +276,9 @@ func (app *application) authorize(next echo.HandlerFunc) echo.HandlerFunc {
 			case !authorized:
 				logger.Info("app#authorize", "userID", userID)
 				logger.Info("app#authorize", "Path", path)
+				if isAPIRequest(c) {
+					return apiNotAuthorized(c, userID)
+				}
 				sessMan.Put(
 					c.Request().Context(),
 					"alert",
@@ -200,6 +295,57 @@ func (app *application) authorize(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// requireActivation is set on routes creating content. Users who have
+// not activated their account yet can browse, but cannot post.
+// Guests are left for the authorize middleware.
+func (app *application) requireActivation(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("userID").(int)
+		if userID == 0 {
+			return next(c)
+		}
+		activated, err := app.models.Users.Activated(userID)
+		if err != nil {
+			return fmt.Errorf("in app#requireActivation: %w", err)
+		}
+		if activated {
+			return next(c)
+		}
+		if isAPIRequest(c) {
+			return apiError(
+				c,
+				http.StatusForbidden,
+				"Activate your account with the link from the email first.",
+			)
+		}
+		app.sessionManager.Put(
+			c.Request().Context(),
+			"alert",
+			components.AlertProps{
+				Title: "Account not activated",
+				Text:  "Activate your account with the link from the email. You can request a new one on your profile.",
+				Icon:  components.Warning,
+			},
+		)
+		profile := fmt.Sprintf("/users/%d", userID)
+		if c.Get("HTMX").(bool) {
+			c.Response().Header().Set("HX-Location", profile)
+			return c.NoContent(http.StatusOK)
+		}
+		return c.Redirect(http.StatusSeeOther, profile)
+	}
+}
+
+// apiNotAuthorized tells guests to authenticate, while
+// logged in users are refused.
+func apiNotAuthorized(c echo.Context, userID int) error {
+	if userID == 0 {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="sad"`)
+		return apiError(c, http.StatusUnauthorized, "Authentication is required.")
+	}
+	return apiError(c, http.StatusForbidden, "You are not authorized to do that.")
+}
+
 func addHtmxToContext(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		_, ok := c.Request().Header[http.CanonicalHeaderKey("HX-Request")]
@@ -217,11 +363,14 @@ func (app *application) middleware(e *echo.Echo) {
 	e.Use(middleware.Secure())
 	e.Use(middleware.CORSWithConfig(corsConfig(app.config)))
 	e.Use(rate_limiter.NewWithConfig(rateLimiterConfig(app.config.env)))
-	e.Use(middleware.CSRF())
+	e.Use(middleware.CSRFWithConfig(csrfConfig))
 	e.Use(echo.WrapMiddleware(app.sessionManager.LoadAndSave))
 	e.Use(app.userIdExtraction)
+	e.Use(app.authenticateBearer)
+	e.Use(app.trackSession)
 	e.Use(app.authorize)
 	e.Use(addHtmxToContext)
+	e.Use(app.requireTwoFactorSetup)
 	e.RouteNotFound("/*", func(c echo.Context) error {
 		return views.Render(c, http.StatusNotFound, pages.Page404())
 	})
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/markdown"
+	"github.com/labstack/echo/v4"
+)
+
+// apiOperation documents route of the JSON API. Input is the struct
+// bound by the handler, parameters and request body are derived from
+// its param, query and json tags and constraints from validate tags.
+type apiOperation struct {
+	Method  string
+	Path    string
+	Summary string
+	Input   any
+	Status  int
+	// Data is returned in the envelope, Meta is set for paginated lists.
+	Data any
+	Meta any
+}
+
+// apiOperations has to match routes registered in apiRoutes,
+// TestOpenAPISpecMatchesRoutes fails when they drift apart.
+var apiOperations = []apiOperation{
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/discussions",
+		Summary: "List discussions",
+		Input:   apiGetDiscussionsInput{},
+		Status:  http.StatusOK,
+		Data:    []apiDiscussion{},
+		Meta:    apiPageMeta{},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/v1/discussions",
+		Summary: "Share link and start discussion, requires activated account",
+		Input:   apiCreateDiscussionInput{},
+		Status:  http.StatusCreated,
+		Data:    apiDiscussion{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/discussions/:id",
+		Summary: "Get discussion",
+		Input:   apiIDInput{},
+		Status:  http.StatusOK,
+		Data:    apiDiscussion{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/discussions/:id/comments",
+		Summary: "List top level comments of discussion",
+		Input:   apiIDPageInput{},
+		Status:  http.StatusOK,
+		Data:    []apiComment{},
+		Meta:    apiPageMeta{},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/v1/discussions/:id/comments",
+		Summary: "Comment discussion or reply to comment, requires activated account",
+		Input:   apiCreateCommentInput{},
+		Status:  http.StatusCreated,
+		Data:    apiComment{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/comments/:id/replies",
+		Summary: "List replies to comment",
+		Input:   apiIDPageInput{},
+		Status:  http.StatusOK,
+		Data:    []apiComment{},
+		Meta:    apiPageMeta{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/users/:id",
+		Summary: "Get public profile of user",
+		Input:   apiIDInput{},
+		Status:  http.StatusOK,
+		Data:    apiUser{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/categories",
+		Summary: "List categories",
+		Status:  http.StatusOK,
+		Data:    []apiCategory{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/reports",
+		Summary: "List reports after the cursor, for moderators",
+		Input:   apiGetReportsInput{},
+		Status:  http.StatusOK,
+		Data:    []apiReport{},
+		Meta:    apiCursorMeta{},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/v1/reports",
+		Summary: "Report user for discussion or comment, requires activated account",
+		Input:   apiCreateReportInput{},
+		Status:  http.StatusCreated,
+		Data:    apiReport{},
+	},
+}
+
+// getOpenAPISpec serves OpenAPI 3 document of the JSON API. Like
+// getRoutes it is built once from the registered routes. Drift is
+// only logged, the spec then documents operations that are registered.
+func (app *application) getOpenAPISpec(e *echo.Echo) echo.HandlerFunc {
+	spec, err := newOpenAPISpec(e.Routes(), apiOperations)
+	if err != nil {
+		app.logger.Warn("JSON API routes and OpenAPI spec drifted apart", "err", err)
+	}
+	body, err := json.Marshal(spec)
+	return func(c echo.Context) error {
+		if err != nil {
+			return fmt.Errorf("in app#getOpenAPISpec: %w", err)
+		}
+		return c.JSONBlob(http.StatusOK, body)
+	}
+}
+
+// newOpenAPISpec documents the operations. Error is returned along
+// with the spec when a route under /api/v1 is not documented or
+// documented operation has no route.
+func newOpenAPISpec(routes []*echo.Route, operations []apiOperation) (map[string]any, error) {
+	registered := make(map[string]bool)
+	for _, r := range routes {
+		if strings.HasPrefix(r.Path, "/api/v1/") && r.Method != echo.RouteNotFound {
+			registered[r.Method+" "+r.Path] = true
+		}
+	}
+
+	var errs []error
+	paths := make(map[string]map[string]any)
+	for _, op := range operations {
+		key := op.Method + " " + op.Path
+		if !registered[key] {
+			errs = append(errs, fmt.Errorf("%s is documented but not registered", key))
+			continue
+		}
+		delete(registered, key)
+		if err := checkPathParams(op); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		path := openAPIPath(op.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(op.Method)] = openAPIOperation(op)
+	}
+	for key := range registered {
+		errs = append(errs, fmt.Errorf("%s is registered but not documented", key))
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "sad JSON API",
+			"version": "1",
+			"description": "Routes are authorized with permissions of the user role. " +
+				"Authenticate with the session cookie or with personal access token.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"Error": map[string]any{
+					"type":     "object",
+					"required": []string{"error"},
+					"properties": map[string]any{
+						"error": openAPISchema(reflect.TypeOf(apiErrorBody{})),
+					},
+				},
+			},
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		// Empty requirement marks authentication as optional,
+		// guests can read public resources.
+		"security": []map[string][]string{{"bearerAuth": {}}, {}},
+	}, errors.Join(errs...)
+}
+
+// checkPathParams makes sure the input binds every param of the path.
+func checkPathParams(op apiOperation) error {
+	var inPath, inInput []string
+	for _, s := range strings.Split(op.Path, "/") {
+		if name, ok := strings.CutPrefix(s, ":"); ok {
+			inPath = append(inPath, name)
+		}
+	}
+	if op.Input != nil {
+		t := reflect.TypeOf(op.Input)
+		for i := 0; i < t.NumField(); i++ {
+			if name := t.Field(i).Tag.Get("param"); name != "" {
+				inInput = append(inInput, name)
+			}
+		}
+	}
+	slices.Sort(inPath)
+	slices.Sort(inInput)
+	if !slices.Equal(inPath, inInput) {
+		return fmt.Errorf(
+			"%s %s has params %v but its input binds %v",
+			op.Method, op.Path, inPath, inInput,
+		)
+	}
+	return nil
+}
+
+// openAPIPath converts echo path params to OpenAPI templates,
+// e.g. /discussions/:id to /discussions/{id}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if name, ok := strings.CutPrefix(s, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func openAPIOperation(op apiOperation) map[string]any {
+	envelope := map[string]any{
+		"type":     "object",
+		"required": []string{"data"},
+		"properties": map[string]any{
+			"data": openAPISchema(reflect.TypeOf(op.Data)),
+		},
+	}
+	if op.Meta != nil {
+		envelope["required"] = []string{"data", "meta"}
+		envelope["properties"].(map[string]any)["meta"] = openAPISchema(reflect.TypeOf(op.Meta))
+	}
+	operation := map[string]any{
+		"summary": op.Summary,
+		"responses": map[string]any{
+			strconv.Itoa(op.Status): map[string]any{
+				"description": http.StatusText(op.Status),
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": envelope},
+				},
+			},
+			"default": map[string]any{
+				"description": "Error",
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": map[string]any{"$ref": "#/components/schemas/Error"},
+					},
+				},
+			},
+		},
+	}
+	if op.Input == nil {
+		return operation
+	}
+
+	parameters := []map[string]any{}
+	body := map[string]any{"type": "object", "properties": map[string]any{}}
+	var bodyRequired []string
+	t := reflect.TypeOf(op.Input)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		required := slices.Contains(validateRules(f), "required")
+		if name := f.Tag.Get("param"); name != "" {
+			parameters = append(parameters, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   openAPIFieldSchema(f),
+			})
+			continue
+		}
+		if name := f.Tag.Get("query"); name != "" {
+			parameters = append(parameters, map[string]any{
+				"name":     name,
+				"in":       "query",
+				"required": required,
+				"schema":   openAPIFieldSchema(f),
+			})
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		body["properties"].(map[string]any)[name] = openAPIFieldSchema(f)
+		if required {
+			bodyRequired = append(bodyRequired, name)
+		}
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if len(body["properties"].(map[string]any)) > 0 {
+		if len(bodyRequired) > 0 {
+			body["required"] = bodyRequired
+		}
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": body},
+			},
+		}
+	}
+	return operation
+}
+
+func validateRules(f reflect.StructField) []string {
+	return strings.Split(f.Tag.Get("validate"), ",")
+}
+
+// openAPIFieldSchema describes input field with the constraints
+// of its validate tag.
+func openAPIFieldSchema(f reflect.StructField) map[string]any {
+	schema := openAPISchema(f.Type)
+	for _, rule := range validateRules(f) {
+		tag, param, _ := strings.Cut(rule, "=")
+		n, nErr := strconv.Atoi(param)
+		switch {
+		case tag == "number":
+			// Ids are bound as strings but they are numbers
+			schema = map[string]any{"type": "integer"}
+		case tag == "url":
+			schema["format"] = "uri"
+		case tag == "oneof":
+			schema["enum"] = strings.Fields(param)
+		case tag == "min" && nErr == nil && f.Type.Kind() == reflect.String:
+			schema["minLength"] = n
+		case tag == "max" && nErr == nil && f.Type.Kind() == reflect.String:
+			schema["maxLength"] = n
+		case tag == "markdown":
+			schema["maxLength"] = markdown.MaxLength
+		case tag == "min" && nErr == nil:
+			schema["minimum"] = n
+		case tag == "max" && nErr == nil:
+			schema["maximum"] = n
+		}
+	}
+	return schema
+}
+
+// openAPISchema describes the type the way encoding/json encodes it.
+func openAPISchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := openAPISchema(t.Elem())
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": openAPISchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": openAPISchema(t.Elem()),
+		}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = openAPISchema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		return map[string]any{}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	e := echo.New()
+	app := &application{}
+	app.apiRoutes(e)
+
+	spec, err := newOpenAPISpec(e.Routes(), apiOperations)
+	if err != nil {
+		t.Fatalf("JSON API routes and apiOperations drifted apart:\n%v", err)
+	}
+	paths := spec["paths"].(map[string]map[string]any)
+	documented := 0
+	for _, operations := range paths {
+		documented += len(operations)
+	}
+	if documented != len(apiOperations) {
+		t.Errorf("spec documents %d operations, want %d", documented, len(apiOperations))
+	}
+}
+
+func TestOpenAPISpecReportsDrift(t *testing.T) {
+	e := echo.New()
+	e.GET("/api/v1/undocumented", func(c echo.Context) error { return nil })
+	operations := []apiOperation{{
+		Method: "GET",
+		Path:   "/api/v1/unregistered",
+		Status: 200,
+		Data:   apiCategory{},
+	}}
+
+	spec, err := newOpenAPISpec(e.Routes(), operations)
+	if err == nil {
+		t.Fatal("expected drift error")
+	}
+	if paths := spec["paths"].(map[string]map[string]any); len(paths) != 0 {
+		t.Errorf("spec documents unregistered operations: %v", paths)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/internal/mailer"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/components"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) forgotPasswordHandler(c echo.Context) error {
+	return views.Render(c, http.StatusOK, pages.ForgotPasswordPage())
+}
+
+// sendPasswordResetHandler responds the same way whether the account
+// exists or not, so it cannot be used to discover registered emails.
+func (app *application) sendPasswordResetHandler(c echo.Context) error {
+	var input struct {
+		Email string `form:"email" validate:"required,email"`
+	}
+	if err := c.Bind(&input); err != nil {
+		app.logger.Error("app#sendPasswordResetHandler", "err", err.Error())
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ForgotPasswordFormBody(input.Email, "Values could not be bind."),
+		)
+	}
+	if err := c.Validate(&input); err != nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ForgotPasswordFormBody(input.Email, "Provide valid email."),
+		)
+	}
+
+	u, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("app#sendPasswordResetHandler", "err", err.Error())
+			return err
+		}
+		return views.Render(c, http.StatusOK, pages.ForgotPasswordSent())
+	}
+
+	// Only the most recently sent link is valid
+	if err := app.models.Tokens.DeleteAllForUser(data.TokenTypePasswordReset, u.ID); err != nil {
+		app.logger.Error("app#sendPasswordResetHandler", "err", err.Error())
+		return err
+	}
+	t, err := app.models.Tokens.New(u.ID, time.Hour, data.TokenTypePasswordReset)
+	if err != nil {
+		app.logger.Error("app#sendPasswordResetHandler", "err", err.Error())
+		return err
+	}
+
+	app.startBackgroundJob(func() {
+		if err := app.mailer.Send(
+			u.Email,
+			mailer.PasswordResetSubject(),
+			mailer.PasswordResetPlainBody(t.PlainText),
+			mailer.PasswordResetHtmlBody(t.PlainText),
+		); err != nil {
+			app.logger.Error(
+				"app#sendPasswordResetHandler while sending email",
+				"err", err.Error(),
+			)
+		}
+	})
+
+	return views.Render(c, http.StatusOK, pages.ForgotPasswordSent())
+}
+
+func (app *application) resetPasswordPageHandler(c echo.Context) error {
+	var input struct {
+		Token string `query:"token" validate:"required,len=26,alphanum"`
+	}
+	if err := c.Bind(&input); err != nil {
+		app.logger.Error("app#resetPasswordPageHandler", "err", err.Error())
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.String(
+			http.StatusBadRequest,
+			"Link is malformed, please visit link from the email again.",
+		)
+	}
+	return views.Render(c, http.StatusOK, pages.ResetPasswordPage(input.Token))
+}
+
+func (app *application) resetPasswordHandler(c echo.Context) error {
+	var input struct {
+		Token                string `form:"token" validate:"required,len=26,alphanum"`
+		Password             string `form:"password" validate:"required,min=8,max=64,containsany=!@#?*,containsany=ABCDEFGHIJKLMNOPQRSTUVWXYZ,containsany=123456789"`
+		PasswordConfirmation string `form:"passwordConfirmation" validate:"required,eqfield=Password"`
+	}
+	if err := c.Bind(&input); err != nil {
+		app.logger.Error("app#resetPasswordHandler", "err", err.Error())
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ResetPasswordFormBody(input.Token, "Values could not be bind."),
+		)
+	}
+	if err := c.Validate(&input); err != nil {
+		errMsg := "Password needs 8 to 64 characters, an uppercase letter, a digit and one of !@#?*."
+		if input.Password != "" && input.Password != input.PasswordConfirmation {
+			errMsg = "Passwords do not match."
+		}
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ResetPasswordFormBody(input.Token, errMsg),
+		)
+	}
+
+	u, err := app.models.Users.GetForToken(data.TokenTypePasswordReset, input.Token)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("app#resetPasswordHandler", "err", err.Error())
+			return err
+		}
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.ResetPasswordFormBody(
+				input.Token,
+				"Link is invalid or has expired, request a new one.",
+			),
+		)
+	}
+
+	if err := u.Password.Set(input.Password); err != nil {
+		app.logger.Error("app#resetPasswordHandler", "err", err.Error())
+		return err
+	}
+	if err := app.models.Users.Update(u); err != nil {
+		app.logger.Error("app#resetPasswordHandler", "err", err.Error())
+		return err
+	}
+	if err := app.models.Tokens.DeleteAllForUser(data.TokenTypePasswordReset, u.ID); err != nil {
+		app.logger.Error("app#resetPasswordHandler", "err", err.Error())
+		return err
+	}
+	// Visiting the link proves the access to the email,
+	// lockout after failed logins is not needed anymore.
+	if err := app.models.Users.Unlock(u.ID); err != nil {
+		app.logger.Error("app#resetPasswordHandler", "err", err.Error())
+		return err
+	}
+
+	ctx := c.Request().Context()
+	if err := app.destroyUserSessions(u.ID); err != nil {
+		app.logger.Error("app#resetPasswordHandler", "err", err.Error())
+		return err
+	}
+	// Session of the current request is saved after the handler
+	// returns, so it is logged out explicitly as well.
+	if err := app.sessionManager.RenewToken(ctx); err != nil {
+		app.logger.Error("app#resetPasswordHandler", "err", err.Error())
+		return err
+	}
+	app.sessionManager.Remove(ctx, "userID")
+
+	app.sessionManager.Put(
+		ctx,
+		"alert",
+		components.AlertProps{
+			Title: "Password changed",
+			Text:  "Your password has been changed, log in with the new one.",
+			Icon:  components.Success,
+		},
+	)
+	c.Response().Header().Set("HX-Location", "/login")
+	return c.NoContent(http.StatusOK)
+}
+
+// destroyUserSessions logs the user out on all devices.
+func (app *application) destroyUserSessions(userID int) error {
+	return app.iterateUserSessions(userID, func(ctx context.Context) error {
+		return app.sessionManager.Destroy(ctx)
+	})
+}
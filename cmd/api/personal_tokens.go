@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/labstack/echo/v4"
+)
+
+// personalTokensViewModel lists active tokens of the user.
+func (app *application) personalTokensViewModel(userID int) (pages.PersonalTokensViewModel, error) {
+	tokens, err := app.models.Tokens.GetAllPersonal(userID)
+	if err != nil {
+		return pages.PersonalTokensViewModel{}, err
+	}
+	const layout = "2006-01-02"
+	vm := pages.PersonalTokensViewModel{}
+	for _, t := range tokens {
+		lastUsedAt := "never"
+		if t.LastUsedAt != nil {
+			lastUsedAt = t.LastUsedAt.Format(layout)
+		}
+		vm.Tokens = append(vm.Tokens, pages.PersonalTokenViewModel{
+			Id:         t.ID,
+			Name:       t.Name,
+			Scopes:     t.Scopes,
+			CreatedAt:  t.CreatedAt.Format(layout),
+			ExpiresAt:  t.ExpiredAt.Format(layout),
+			LastUsedAt: lastUsedAt,
+		})
+	}
+	return vm, nil
+}
+
+// Tokens can only be managed from the browser session, so a leaked
+// token can not be used to issue new ones.
+func (app *application) getPersonalTokensHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	vm, err := app.personalTokensViewModel(c.Get("userID").(int))
+	if err != nil {
+		return fmt.Errorf("in app#getPersonalTokensHandler: %w", err)
+	}
+	return views.Render(c, http.StatusOK, pages.PersonalTokensPage(vm))
+}
+
+func (app *application) createPersonalTokenHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	var input struct {
+		Name      string   `form:"name" validate:"required,max=64"`
+		Scopes    []string `form:"scopes" validate:"required,min=1,max=2,unique,dive,oneof=read write"`
+		ExpiresIn string   `form:"expiresIn" validate:"required,oneof=7 30 90 365"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+
+	uID := c.Get("userID").(int)
+	vm, err := app.personalTokensViewModel(uID)
+	if err != nil {
+		return fmt.Errorf("in app#createPersonalTokenHandler: %w", err)
+	}
+	if err := c.Validate(&input); err != nil {
+		vm.Name = input.Name
+		vm.ErrMsg = "Provide name up to 64 characters and pick at least one scope."
+		return views.Render(c, http.StatusOK, pages.PersonalTokens(vm))
+	}
+	days, err := strconv.Atoi(input.ExpiresIn)
+	if err != nil {
+		return err
+	}
+
+	t, err := app.models.Tokens.NewPersonal(
+		uID,
+		input.Name,
+		data.TokenScopes(input.Scopes),
+		time.Duration(days)*24*time.Hour,
+	)
+	if err != nil {
+		if errors.Is(err, data.ErrTooManyTokens) {
+			vm.Name = input.Name
+			vm.ErrMsg = fmt.Sprintf(
+				"You can have at most %d tokens, revoke some first.",
+				data.MaxPersonalTokens,
+			)
+			return views.Render(c, http.StatusOK, pages.PersonalTokens(vm))
+		}
+		return fmt.Errorf("in app#createPersonalTokenHandler: %w", err)
+	}
+
+	vm, err = app.personalTokensViewModel(uID)
+	if err != nil {
+		return fmt.Errorf("in app#createPersonalTokenHandler: %w", err)
+	}
+	vm.NewToken = t.PlainText
+	return views.Render(c, http.StatusOK, pages.PersonalTokens(vm))
+}
+
+func (app *application) deletePersonalTokenHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	var input struct {
+		ID string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	id, err := strconv.ParseInt(input.ID, 10, 64)
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	uID := c.Get("userID").(int)
+	if err := app.models.Tokens.DeletePersonal(uID, id); err != nil &&
+		!errors.Is(err, data.ErrRecordNotFound) {
+		return fmt.Errorf("in app#deletePersonalTokenHandler: %w", err)
+	}
+	vm, err := app.personalTokensViewModel(uID)
+	if err != nil {
+		return fmt.Errorf("in app#deletePersonalTokenHandler: %w", err)
+	}
+	return views.Render(c, http.StatusOK, pages.PersonalTokens(vm))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/components"
+	"github.com/labstack/echo/v4"
+)
+
+// previewPollInterval is the time idle worker waits
+// before checking the queue again.
+const previewPollInterval = 2 * time.Second
+
+// startPreviewWorkers launches workers generating discussion previews
+// queued in the database. Workers stop once ctx is done and are tracked
+// by the wait group so the server waits for screenshots in progress.
+func (app *application) startPreviewWorkers(ctx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.runPreviewWorker(ctx)
+		}()
+	}
+	app.logger.Info("preview workers started", "workers", n)
+}
+
+func (app *application) runPreviewWorker(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, err := app.models.PreviewJobs.Claim()
+		if err == nil {
+			app.processPreviewJob(job)
+			continue
+		}
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("app#runPreviewWorker", "err", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(previewPollInterval):
+		}
+	}
+}
+
+func (app *application) processPreviewJob(job *data.PreviewJob) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.failPreviewJob(job, fmt.Errorf("%s", err))
+		}
+	}()
+
+	// Metadata is optional, discussion can do without it
+	// so failing to fetch it does not fail the job.
+	if job.Attempts == 1 {
+		app.fetchDiscussionMetadata(job)
+	}
+
+	previewSrc, err := app.services.ChromeDp.GenScreenshot(job.Url)
+	if err != nil {
+		app.failPreviewJob(job, err)
+		return
+	}
+	if err := app.models.PreviewJobs.Complete(job, previewSrc); err != nil {
+		// Discussion is gone or preview could not be saved,
+		// either way the screenshot is of no use.
+		_ = app.services.ChromeDp.RemoveScreenshot(previewSrc)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return
+		}
+		app.failPreviewJob(job, err)
+		return
+	}
+	app.logger.Info(
+		"preview generated",
+		"discussionID", job.DiscussionID,
+		"attempt", job.Attempts,
+	)
+}
+
+func (app *application) fetchDiscussionMetadata(job *data.PreviewJob) {
+	meta, err := app.services.Metadata.Fetch(job.Url)
+	if err != nil {
+		app.logger.Info(
+			"app#fetchDiscussionMetadata",
+			"discussionID", job.DiscussionID,
+			"err", err.Error(),
+		)
+		return
+	}
+	app.services.Metadata.StoreImages(meta)
+	if err := app.models.Discussions.UpdateMetadata(
+		job.DiscussionID,
+		data.DiscussionMetadata{
+			Title:        meta.Title,
+			Description:  meta.Description,
+			ImageUrl:     meta.ImageUrl,
+			SiteName:     meta.SiteName,
+			FaviconUrl:   meta.FaviconUrl,
+			CanonicalUrl: meta.CanonicalUrl,
+		},
+	); err != nil {
+		// Discussion is gone or metadata could not be saved,
+		// either way the images are of no use.
+		_ = app.services.Metadata.RemoveImages(meta.ImageUrl, meta.FaviconUrl)
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Error("app#fetchDiscussionMetadata", "err", err.Error())
+		}
+	}
+}
+
+// discussionCardPreview picks image displayed on the card of the
+// discussion. Image provided by the page itself, stored along with
+// the metadata, is preferred over the screenshot, so the card does
+// not wait for the latter.
+func discussionCardPreview(d *data.Discussion) (imgSrc, status string) {
+	if d.Metadata.ImageUrl != "" {
+		return d.Metadata.ImageUrl, string(data.PreviewReady)
+	}
+	return d.PreviewSrc, string(d.PreviewStatus)
+}
+
+func (app *application) failPreviewJob(job *data.PreviewJob, reason error) {
+	app.logger.Error(
+		"app#processPreviewJob",
+		"discussionID", job.DiscussionID,
+		"attempt", job.Attempts,
+		"err", reason.Error(),
+	)
+	if err := app.models.PreviewJobs.Fail(job, reason.Error()); err != nil {
+		app.logger.Error("app#failPreviewJob", "err", err.Error())
+	}
+}
+
+// getDiscussionPreviewHandler is polled by cards of discussions whose
+// preview is still being generated. No content is returned until the
+// preview is ready or failed, so htmx keeps polling.
+func (app *application) getDiscussionPreviewHandler(c echo.Context) error {
+	var input struct {
+		Id string `param:"id" validate:"required,number"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	discussionId, err := strconv.Atoi(input.Id)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+
+	d, err := app.models.Discussions.Get(int64(discussionId))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return c.String(http.StatusNotFound, "discussion not found")
+		}
+		app.logger.Error("app#getDiscussionPreviewHandler", "err", err.Error())
+		return c.String(http.StatusInternalServerError, "internal server error")
+	}
+	imgSrc, status := discussionCardPreview(d)
+	if status == string(data.PreviewPending) {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	return views.Render(
+		c,
+		http.StatusOK,
+		components.DiscussionCardFigure(
+			components.DiscussionCardViewModel{
+				Id:            d.ID,
+				ImgSrc:        imgSrc,
+				PreviewStatus: status,
+			},
+			false,
+		),
+	)
+}
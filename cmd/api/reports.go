@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/N0tR1CH/sad/internal/services"
 	"github.com/N0tR1CH/sad/views"
 	"github.com/N0tR1CH/sad/views/pages"
 	"github.com/labstack/echo/v4"
@@ -46,7 +47,10 @@ func (app *application) getReportsHandler(c echo.Context) error {
 		rowsProps[i].DiscussionId = reports[i].DiscussionID
 		rowsProps[i].CommentId = reports[i].CommentID
 		rowsProps[i].ReportedAt = reports[i].CreatedAt
-		rowsProps[i].UserAvatarSrc = reports[i].ReportedUser.AvatarSrc
+		rowsProps[i].UserAvatarSrc = services.AvatarVariant(
+			reports[i].ReportedUser.AvatarSrc,
+			64,
+		)
 	}
 	return views.Render(
 		c,
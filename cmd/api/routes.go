@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
 	"os"
 
@@ -22,12 +23,14 @@ func (app *application) routes() http.Handler {
 		),
 	)
 
+	r.IPExtractor = app.ipExtractor()
+	r.HTTPErrorHandler = app.httpErrorHandler(r)
 	app.middleware(r)
 
 	staticFilesHandler := app.staticFilesHandler()
 
 	r.GET("/", app.homeHandler)
-	r.Static("/public", "cmd/web/public")
+	r.Static("/public", app.config.storage.dir)
 	r.GET("/static/*", echo.WrapHandler(staticFilesHandler))
 	r.GET("/healthcheck", app.healthcheckhandler)
 	r.GET("/login", app.loginHandler)
@@ -35,17 +38,48 @@ func (app *application) routes() http.Handler {
 		return c.Redirect(http.StatusTemporaryRedirect, "/login")
 	})
 	r.GET("/alert", app.flashMessageHandler)
+	// GET /search?q=[string]&category=[string]&page=[int]
+	r.GET("/search", app.searchHandler)
+	// POST /markdown/preview
+	//
+	// FormData:
+	// - content: string
+	r.POST("/markdown/preview", app.previewMarkdownHandler)
 
 	app.discussionsRoutes(r)
 	app.usersRoutes(r)
 	app.categoriesRoutes(r)
 	app.rolesRoutes(r)
 	app.reportsRoutes(r)
+	app.apiRoutes(r)
+	r.GET("/api/openapi.json", app.getOpenAPISpec(r))
+
+	// Runtime metrics, e.g. headless browser pool usage
+	r.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
 
 	r.GET("/routes", app.getRoutes(r))
 	return r
 }
 
+// ipExtractor decides what c.RealIP returns, login throttling and
+// rate limiting depend on it. X-Forwarded-For is trusted only when
+// the request comes from one of the configured proxies, otherwise
+// clients could rotate the header to get past the limits.
+func (app *application) ipExtractor() echo.IPExtractor {
+	if len(app.config.trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipNet := range app.config.trustedProxies {
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
 func (app *application) getRoutes(e *echo.Echo) echo.HandlerFunc {
 	routes := e.Routes()
 	app.permissions = make([]data.Permission, 0, len(routes)+1)
@@ -113,18 +147,36 @@ func (app *application) staticFilesHandler() http.Handler {
 func (app *application) discussionsRoutes(e *echo.Echo) {
 	g := e.Group("/discussions", echo.WrapMiddleware(app.sessionManager.LoadAndSave))
 	// Getting all discussions
+	//
+	// QueryParams:
+	// - page: int
+	// - category: string
+	// - sort: hot (default) | new | top-day | top-week | top-all
 	g.GET("", app.getDiscussionsHandler)
 	// Getting certain discussion
 	g.GET("/:id", app.getDiscussionHandler)
-	// Creating new discussion
-	g.GET("/new", app.newDiscussionHandler)
-	g.POST("/create", app.createDiscussionHandler)
+	// Editing and deleting certain discussion
+	g.GET("/:id/edit", app.editDiscussionHandler)
+	g.PUT("/:id", app.updateDiscussionHandler)
+	g.DELETE("/:id", app.deleteDiscussionHandler)
+	// Upvoting certain discussion
+	g.POST("/:id/upvote", app.upvoteDiscussionHandler)
+	// Creating new discussion, requires activated account
+	g.GET("/new", app.newDiscussionHandler, app.requireActivation)
+	// Title of the shared page prefilling the form
+	//
+	// QueryParams:
+	// - url: string
+	g.GET("/new/title", app.getSuggestedTitleHandler, app.requireActivation)
+	g.POST("/create", app.createDiscussionHandler, app.requireActivation)
 	// Validating discussion fields
 	g.GET("/title", app.validateDiscussionTitleHandler)
 	g.GET("/description", app.validateDiscussionDescriptionHandler)
 	g.GET("/url", app.validateDiscussionUrlHandler)
 	// Generating discussion card preview
 	g.GET("/preview", app.genDiscussionPreview)
+	// Polling preview image generated in the background
+	g.GET("/:id/preview", app.getDiscussionPreviewHandler)
 
 	app.commentsRoutes(g)
 }
@@ -137,9 +189,20 @@ func (app *application) commentsRoutes(e *echo.Group) {
 	})
 
 	g.GET("", app.getCommentsHandler)
-	g.POST("/create", app.createCommentHandler)
+	// Posting comments requires activated account
+	g.POST("/create", app.createCommentHandler, app.requireActivation)
+	// Voting on comments, voting the same way again retracts the vote
 	g.POST("/:id/upvote", app.upvoteCommentHandler)
+	g.POST("/:id/downvote", app.downvoteCommentHandler)
 	g.GET("/:id/reply", app.getCommentRepliesHandler)
+	// Editing comments within the edit window and deleting them,
+	// deleted comment is kept as a tombstone with its replies
+	g.GET("/:id", app.getCommentHandler)
+	g.GET("/:id/edit", app.editCommentHandler)
+	g.PUT("/:id", app.updateCommentHandler)
+	g.DELETE("/:id", app.deleteCommentHandler)
+	// Previous versions of edited comment
+	g.GET("/:id/revisions", app.getCommentRevisionsHandler)
 }
 
 // Create users group and sets its middleware.
@@ -171,6 +234,110 @@ func (app *application) usersRoutes(e *echo.Echo) {
 	// - id: integer
 	g.POST("/:id/deauthenticate", app.deauthenticateUserHandler)
 
+	// GET /users/password/forgot
+	g.GET("/password/forgot", app.forgotPasswordHandler)
+
+	// POST /users/password/forgot
+	//
+	// FormData:
+	// - email: string
+	g.POST("/password/forgot", app.sendPasswordResetHandler)
+
+	// GET /users/password/reset?token=[string]
+	g.GET("/password/reset", app.resetPasswordPageHandler)
+
+	// POST /users/password/reset
+	//
+	// FormData:
+	// - token: string
+	// - password: string
+	// - passwordConfirmation: string
+	g.POST("/password/reset", app.resetPasswordHandler)
+
+	// GET /users/2fa
+	//
+	// Enrollment or settings of the two-factor authentication.
+	g.GET("/2fa", app.getTwoFactorHandler)
+
+	// POST /users/2fa
+	//
+	// FormData:
+	// - code: string
+	g.POST("/2fa", app.enableTwoFactorHandler)
+
+	// DELETE /users/2fa
+	//
+	// FormData:
+	// - password: string
+	g.DELETE("/2fa", app.disableTwoFactorHandler)
+
+	// GET /users/2fa/verify
+	g.GET("/2fa/verify", app.getTwoFactorVerifyHandler)
+
+	// POST /users/2fa/verify
+	//
+	// FormData:
+	// - code: string (from the authenticator app or recovery code)
+	g.POST("/2fa/verify", app.verifyTwoFactorHandler)
+
+	// GET /users/tokens
+	g.GET("/tokens", app.getPersonalTokensHandler)
+
+	// POST /users/tokens
+	//
+	// FormData:
+	// - name: string
+	// - scopes: read | write (repeated)
+	// - expiresIn: 7 | 30 | 90 | 365 (days)
+	g.POST("/tokens", app.createPersonalTokenHandler)
+
+	// DELETE /users/tokens/:id=[int]
+	g.DELETE("/tokens/:id", app.deletePersonalTokenHandler)
+
+	// GET /users/sessions
+	//
+	// Security page listing devices the user is logged in on.
+	g.GET("/sessions", app.getSessionsHandler)
+
+	// DELETE /users/sessions
+	//
+	// Logs out of all sessions except the current one.
+	g.DELETE("/sessions", app.deleteOtherSessionsHandler)
+
+	// DELETE /users/sessions/:id=[string]
+	g.DELETE("/sessions/:id", app.deleteSessionHandler)
+
+	// GET /users/data
+	//
+	// Export of personal data and deletion of the account.
+	g.GET("/data", app.getAccountDataHandler)
+
+	// POST /users/data/export
+	g.POST("/data/export", app.requestDataExportHandler)
+
+	// GET /users/data/export/:id=[int]
+	//
+	// Zip archive with data.json and the avatar.
+	g.GET("/data/export/:id", app.downloadDataExportHandler)
+
+	// POST /users/data/deletion
+	//
+	// FormData:
+	// - password: string
+	g.POST("/data/deletion", app.scheduleAccountDeletionHandler)
+
+	// DELETE /users/data/deletion
+	g.DELETE("/data/deletion", app.cancelAccountDeletionHandler)
+
+	// GET /users/email/confirm?token=[string]
+	g.GET("/email/confirm", app.confirmEmailPageHandler)
+
+	// PUT /users/email/confirm
+	//
+	// FormData:
+	// - token: string
+	g.PUT("/email/confirm", app.confirmEmailHandler)
+
 	// GET /users/validateEmail?email=[string]
 	g.GET("/validateEmail", app.validateUserEmailHandler)
 
@@ -183,12 +350,36 @@ func (app *application) usersRoutes(e *echo.Echo) {
 	// GET /users/activated/:id/activated?token=[string]
 	g.GET("/:id/activated", app.getUserActivationSectionHandler)
 
+	// POST /users/activation
+	//
+	// Sends new activation link to the logged in user.
+	g.POST("/activation", app.resendActivationHandler)
+
 	// GET /users/:id/avatar
 	//
 	// Params:
 	// - id: integer
 	g.GET("/:id/avatar", app.getUserAvatarHandler)
 
+	// GET /users/:id=[int]/avatar/edit
+	g.GET("/:id/avatar/edit", app.editUserAvatarHandler)
+
+	// PUT /users/:id=[int]/avatar
+	//
+	// FormData:
+	// - avatar: file
+	g.PUT("/:id/avatar", app.updateUserAvatarHandler)
+
+	// GET /users/:id=[int]/email/edit
+	g.GET("/:id/email/edit", app.editUserEmailHandler)
+
+	// PUT /users/:id=[int]/email
+	//
+	// FormData:
+	// - email: string
+	// - password: string
+	g.PUT("/:id/email", app.updateUserEmailHandler)
+
 	// PUT /users/activated/:id/activated
 	//
 	// FormData:
@@ -214,7 +405,7 @@ func (app *application) usersRoutes(e *echo.Echo) {
 	// - reason: string
 	// - discussionId: nil (if commentId of type int) | int (if discussionId of type nil)
 	// - commentId: nil (if discussionId of type int) | int (if commentId of type nil)
-	g.POST("/:id/report", app.reportUserHandler)
+	g.POST("/:id/report", app.reportUserHandler, app.requireActivation)
 
 	g.PUT("/:id/banned", app.banUserHandler)
 }
@@ -252,3 +443,63 @@ func (app *application) reportsRoutes(e *echo.Echo) {
 
 	g.GET("", app.getReportsHandler)
 }
+
+// JSON API for integrations and mobile clients, /api/v1/*
+//
+// Routes are authorized with the same role permissions as the HTML
+// ones, clients authenticate with the session cookie or with
+// personal access token in the Authorization header. Request bodies
+// are JSON, see apiEnvelope for the shape of responses.
+func (app *application) apiRoutes(e *echo.Echo) {
+	g := e.Group("/api/v1")
+
+	g.RouteNotFound("/*", func(c echo.Context) error {
+		return apiError(c, http.StatusNotFound, "Resource does not exist.")
+	})
+
+	// GET /api/v1/discussions?page=[int]&category=[string]&sort=[string]
+	g.GET("/discussions", app.apiGetDiscussionsHandler)
+
+	// POST /api/v1/discussions, requires activated account
+	//
+	// Body:
+	// - title: string
+	// - description: string
+	// - url: string
+	// - category_id: int
+	g.POST("/discussions", app.apiCreateDiscussionHandler, app.requireActivation)
+
+	// GET /api/v1/discussions/:id=[int]
+	g.GET("/discussions/:id", app.apiGetDiscussionHandler)
+
+	// GET /api/v1/discussions/:id=[int]/comments?page=[int]
+	g.GET("/discussions/:id/comments", app.apiGetCommentsHandler)
+
+	// POST /api/v1/discussions/:id=[int]/comments, requires activated account
+	//
+	// Body:
+	// - content: string
+	// - parent_id: int (optional, for replies)
+	g.POST("/discussions/:id/comments", app.apiCreateCommentHandler, app.requireActivation)
+
+	// GET /api/v1/comments/:id=[int]/replies?page=[int]
+	g.GET("/comments/:id/replies", app.apiGetCommentRepliesHandler)
+
+	// GET /api/v1/users/:id=[int]
+	g.GET("/users/:id", app.apiGetUserHandler)
+
+	// GET /api/v1/categories
+	g.GET("/categories", app.apiGetCategoriesHandler)
+
+	// GET /api/v1/reports?after=[int]&limit=[int]
+	g.GET("/reports", app.apiGetReportsHandler)
+
+	// POST /api/v1/reports, requires activated account
+	//
+	// Body:
+	// - user_id: int
+	// - reason: string
+	// - discussion_id: int (if comment_id is not set)
+	// - comment_id: int (if discussion_id is not set)
+	g.POST("/reports", app.apiCreateReportHandler, app.requireActivation)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/components"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) searchHandler(c echo.Context) error {
+	var input struct {
+		Query    string `query:"q" validate:"max=200"`
+		Category string `query:"category" validate:"max=50"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.String(http.StatusBadRequest, "Search query is too long!")
+	}
+	input.Query = strings.TrimSpace(input.Query)
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	if !c.Get("HTMX").(bool) || c.Get("Boosted").(bool) {
+		categories, err := app.models.Categories.GetAll()
+		if err != nil {
+			return err
+		}
+		cps := make(components.CategoriesProps, len(categories))
+		for i := range cps {
+			cps[i].ID = categories[i].ID
+			cps[i].Name = categories[i].Name
+		}
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.SearchPage(
+				pages.SearchPageProps{
+					Query:      input.Query,
+					Category:   input.Category,
+					Categories: cps,
+				},
+			),
+		)
+	}
+
+	if input.Query == "" {
+		return views.Render(c, http.StatusOK, pages.SearchNoResults(""))
+	}
+
+	results, err := app.models.Discussions.Search(input.Query, input.Category, page)
+	if err != nil {
+		app.logger.Error("app#searchHandler", "err", err.Error())
+		return c.String(
+			http.StatusInternalServerError,
+			"Couldn't search discussions!",
+		)
+	}
+	if len(results) == 0 && page == 1 {
+		return views.Render(c, http.StatusOK, pages.SearchNoResults(input.Query))
+	}
+
+	dcvms := make([]components.DiscussionCardViewModel, len(results))
+	for i := range results {
+		imgSrc, previewStatus := discussionCardPreview(&results[i].Discussion)
+		dcvms[i] = components.DiscussionCardViewModel{
+			Id:            results[i].ID,
+			ImgSrc:        imgSrc,
+			PreviewStatus: previewStatus,
+			CardTitle:     results[i].Title,
+			NumUpvotes:    results[i].NumUpvotes,
+			SiteName:      results[i].Metadata.SiteName,
+			FaviconSrc:    results[i].Metadata.FaviconUrl,
+			TitleHighlight: views.Highlight(
+				results[i].TitleHeadline,
+				data.HighlightStart,
+				data.HighlightStop,
+			),
+			Snippet: views.Highlight(
+				results[i].DescriptionHeadline,
+				data.HighlightStart,
+				data.HighlightStop,
+			),
+		}
+	}
+
+	nextPageParams := url.Values{}
+	nextPageParams.Set("q", input.Query)
+	nextPageParams.Set("category", input.Category)
+	nextPageParams.Set("page", strconv.Itoa(page+1))
+	return views.Render(
+		c,
+		http.StatusOK,
+		components.DiscussionCards(dcvms, "/search?"+nextPageParams.Encode()),
+	)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/alexedwards/scs/pgxstore"
+	"github.com/alexedwards/scs/v2"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	sessionInfoKey = "sessionInfo"
+	// sessionSeenInterval limits how often the last seen time is
+	// refreshed, so not every request has to write the session.
+	sessionSeenInterval = time.Minute
+)
+
+// sessionInfo describes the device the user logged in from, it is
+// kept in the session and listed on the security page. ID tells
+// sessions apart without revealing their tokens.
+type sessionInfo struct {
+	ID         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	UserAgent  string
+	IP         string
+}
+
+// userSessionStore finds, deletes and cleans sessions up the same
+// way pgxstore does, sessions are committed together with the user
+// they belong to though, so they are indexed by the user.
+type userSessionStore struct {
+	*pgxstore.PostgresStore
+	codec  scs.Codec
+	models data.Models
+}
+
+func (uss userSessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	_, values, err := uss.codec.Decode(b)
+	if err != nil {
+		return fmt.Errorf("in userSessionStore#Commit: %w", err)
+	}
+	userID, _ := values["userID"].(int)
+	return uss.models.Sessions.Commit(token, b, expiry, userID)
+}
+
+func newSessionInfo(c echo.Context) (sessionInfo, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return sessionInfo{}, err
+	}
+	now := time.Now()
+	return sessionInfo{
+		ID:         hex.EncodeToString(b),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		UserAgent:  c.Request().UserAgent(),
+		IP:         c.RealIP(),
+	}, nil
+}
+
+// logIn starts session of the user with a new token,
+// so the token from before the login can not be reused.
+func (app *application) logIn(c echo.Context, userID int) error {
+	ctx := c.Request().Context()
+	if err := app.sessionManager.RenewToken(ctx); err != nil {
+		return fmt.Errorf("in app#logIn: %w", err)
+	}
+	info, err := newSessionInfo(c)
+	if err != nil {
+		return fmt.Errorf("in app#logIn: %w", err)
+	}
+	app.sessionManager.Put(ctx, "userID", userID)
+	app.sessionManager.Put(ctx, sessionInfoKey, info)
+	return nil
+}
+
+// trackSession refreshes the last seen time and address of logged
+// in sessions. Sessions started before they were tracked get their
+// info on the first request.
+func (app *application) trackSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		if tokenAuthenticated(c) || app.sessionManager.GetInt(ctx, "userID") == 0 {
+			return next(c)
+		}
+		info, ok := app.sessionManager.Get(ctx, sessionInfoKey).(sessionInfo)
+		if !ok {
+			var err error
+			if info, err = newSessionInfo(c); err != nil {
+				return fmt.Errorf("in app#trackSession: %w", err)
+			}
+			app.sessionManager.Put(ctx, sessionInfoKey, info)
+		}
+		if time.Since(info.LastSeenAt) >= sessionSeenInterval {
+			info.LastSeenAt = time.Now()
+			info.UserAgent = c.Request().UserAgent()
+			info.IP = c.RealIP()
+			app.sessionManager.Put(ctx, sessionInfoKey, info)
+		}
+		return next(c)
+	}
+}
+
+// iterateUserSessions calls fn with context of every session of the
+// user, the same as Iterate of the session manager does for all of them.
+func (app *application) iterateUserSessions(
+	userID int,
+	fn func(ctx context.Context) error,
+) error {
+	tokens, err := app.models.Sessions.UserTokens(userID)
+	if err != nil {
+		return fmt.Errorf("in app#iterateUserSessions: %w", err)
+	}
+	for _, token := range tokens {
+		// Session already loaded into the context would be returned
+		// by Load, so the one of the request can not be passed.
+		ctx, err := app.sessionManager.Load(context.Background(), token)
+		if err != nil {
+			return fmt.Errorf("in app#iterateUserSessions: %w", err)
+		}
+		// Session might have ended or changed its user in the meantime
+		if app.sessionManager.GetInt(ctx, "userID") != userID {
+			continue
+		}
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userSessions lists sessions of the user, recently used first.
+func (app *application) userSessions(userID int) ([]sessionInfo, error) {
+	var infos []sessionInfo
+	if err := app.iterateUserSessions(userID, func(ctx context.Context) error {
+		if info, ok := app.sessionManager.Get(ctx, sessionInfoKey).(sessionInfo); ok {
+			infos = append(infos, info)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in app#userSessions: %w", err)
+	}
+	slices.SortFunc(infos, func(a, b sessionInfo) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return infos, nil
+}
+
+// destroySessions logs the user out of sessions matching revoke,
+// the session of the current request is never destroyed.
+func (app *application) destroySessions(
+	ctx context.Context,
+	userID int,
+	revoke func(info sessionInfo) bool,
+) (destroyed int, err error) {
+	currentToken := app.sessionManager.Token(ctx)
+	err = app.iterateUserSessions(userID, func(ctx context.Context) error {
+		if app.sessionManager.Token(ctx) == currentToken {
+			return nil
+		}
+		info, _ := app.sessionManager.Get(ctx, sessionInfoKey).(sessionInfo)
+		if !revoke(info) {
+			return nil
+		}
+		destroyed++
+		return app.sessionManager.Destroy(ctx)
+	})
+	if err != nil {
+		return destroyed, fmt.Errorf("in app#destroySessions: %w", err)
+	}
+	return destroyed, nil
+}
+
+func (app *application) sessionsViewModel(c echo.Context) (pages.SessionsViewModel, error) {
+	ctx := c.Request().Context()
+	infos, err := app.userSessions(c.Get("userID").(int))
+	if err != nil {
+		return pages.SessionsViewModel{}, err
+	}
+	current, _ := app.sessionManager.Get(ctx, sessionInfoKey).(sessionInfo)
+	const layout = "2006-01-02 15:04 MST"
+	// Stored copy of the current session is saved after the
+	// request, the one in memory is newer and listed first.
+	infos = slices.DeleteFunc(infos, func(info sessionInfo) bool {
+		return info.ID == current.ID
+	})
+	infos = slices.Insert(infos, 0, current)
+	vm := pages.SessionsViewModel{}
+	for _, info := range infos {
+		vm.Sessions = append(vm.Sessions, pages.SessionViewModel{
+			Id:         info.ID,
+			Device:     describeUserAgent(info.UserAgent),
+			IP:         info.IP,
+			CreatedAt:  info.CreatedAt.UTC().Format(layout),
+			LastSeenAt: info.LastSeenAt.UTC().Format(layout),
+			Current:    info.ID == current.ID,
+		})
+	}
+	return vm, nil
+}
+
+// describeUserAgent names browser and operating system of the
+// user agent, it does not need to recognize every one of them.
+func describeUserAgent(ua string) string {
+	browser := "Unknown browser"
+	for _, b := range [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b[0]) {
+			browser = b[1]
+			break
+		}
+	}
+	for _, system := range [][2]string{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Mac OS X", "macOS"},
+		{"Windows", "Windows"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, system[0]) {
+			return browser + " on " + system[1]
+		}
+	}
+	return browser
+}
+
+// Sessions can only be managed from the browser session,
+// the same as personal access tokens.
+func (app *application) getSessionsHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	vm, err := app.sessionsViewModel(c)
+	if err != nil {
+		return fmt.Errorf("in app#getSessionsHandler: %w", err)
+	}
+	return views.Render(c, http.StatusOK, pages.SessionsPage(vm))
+}
+
+// deleteSessionHandler revokes other session of the user,
+// the current one is ended by logging out.
+func (app *application) deleteSessionHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	var input struct {
+		ID string `param:"id" validate:"required,len=32,hexadecimal"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+
+	ctx := c.Request().Context()
+	current, _ := app.sessionManager.Get(ctx, sessionInfoKey).(sessionInfo)
+	if input.ID == current.ID {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	destroyed, err := app.destroySessions(
+		ctx,
+		c.Get("userID").(int),
+		func(info sessionInfo) bool { return info.ID == input.ID },
+	)
+	if err != nil {
+		return fmt.Errorf("in app#deleteSessionHandler: %w", err)
+	}
+	vm, err := app.sessionsViewModel(c)
+	if err != nil {
+		return fmt.Errorf("in app#deleteSessionHandler: %w", err)
+	}
+	if destroyed == 0 {
+		vm.Msg = "Session has already ended."
+	}
+	return views.Render(c, http.StatusOK, pages.Sessions(vm))
+}
+
+func (app *application) deleteOtherSessionsHandler(c echo.Context) error {
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
+	ctx := c.Request().Context()
+	current, _ := app.sessionManager.Get(ctx, sessionInfoKey).(sessionInfo)
+	destroyed, err := app.destroySessions(
+		ctx,
+		c.Get("userID").(int),
+		func(info sessionInfo) bool { return info.ID != current.ID },
+	)
+	if err != nil {
+		return fmt.Errorf("in app#deleteOtherSessionsHandler: %w", err)
+	}
+	vm, err := app.sessionsViewModel(c)
+	if err != nil {
+		return fmt.Errorf("in app#deleteOtherSessionsHandler: %w", err)
+	}
+	vm.Msg = fmt.Sprintf("Logged out of %d other session(s).", destroyed)
+	return views.Render(c, http.StatusOK, pages.Sessions(vm))
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/data"
+	"github.com/N0tR1CH/sad/views"
+	"github.com/N0tR1CH/sad/views/components"
+	"github.com/N0tR1CH/sad/views/pages"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// twoFactorLoginTimeout is the time user has for the second
+	// step of the login after providing the right password.
+	twoFactorLoginTimeout = 5 * time.Minute
+	// maxTwoFactorAttempts is the number of wrong codes after
+	// which the user has to start the login from the beginning.
+	// Wrong codes are also counted as failed login attempts of
+	// the account, so starting over does not allow more guesses.
+	maxTwoFactorAttempts = 5
+)
+
+// Session keys of the login waiting for the second step.
+const (
+	twoFactorUserIDKey    = "twoFactorUserID"
+	twoFactorStartedAtKey = "twoFactorStartedAt"
+	twoFactorAttemptsKey  = "twoFactorAttempts"
+)
+
+// twoFactorSetupPaths can be visited by administrators
+// who have not set up 2FA yet.
+var twoFactorSetupPaths = map[string]bool{
+	"/users/2fa":                true,
+	"/users/:id/deauthenticate": true,
+	"/users/:id/avatar":         true,
+	"/alert":                    true,
+	"/static/*":                 true,
+}
+
+// startTwoFactorLogin remembers the user who provided the right
+// password, userID is put into the session only after the code
+// from the authenticator app is verified.
+func (app *application) startTwoFactorLogin(c echo.Context, userID int) error {
+	ctx := c.Request().Context()
+	if err := app.sessionManager.RenewToken(ctx); err != nil {
+		return fmt.Errorf("in app#startTwoFactorLogin: %w", err)
+	}
+	app.sessionManager.Put(ctx, twoFactorUserIDKey, userID)
+	app.sessionManager.Put(ctx, twoFactorStartedAtKey, time.Now())
+	app.sessionManager.Put(ctx, twoFactorAttemptsKey, 0)
+	c.Response().Header().Set("HX-Location", "/users/2fa/verify")
+	return c.NoContent(http.StatusOK)
+}
+
+func (app *application) clearTwoFactorLogin(c echo.Context) {
+	ctx := c.Request().Context()
+	app.sessionManager.Remove(ctx, twoFactorUserIDKey)
+	app.sessionManager.Remove(ctx, twoFactorStartedAtKey)
+	app.sessionManager.Remove(ctx, twoFactorAttemptsKey)
+}
+
+// pendingTwoFactorUserID returns id of the user in the middle
+// of the login, 0 is returned when there is none or it expired.
+func (app *application) pendingTwoFactorUserID(c echo.Context) int {
+	ctx := c.Request().Context()
+	userID := app.sessionManager.GetInt(ctx, twoFactorUserIDKey)
+	startedAt := app.sessionManager.GetTime(ctx, twoFactorStartedAtKey)
+	if userID == 0 || time.Since(startedAt) > twoFactorLoginTimeout {
+		return 0
+	}
+	return userID
+}
+
+func (app *application) getTwoFactorHandler(c echo.Context) error {
+	uID := c.Get("userID").(int)
+	tf, err := app.models.TwoFactor.Get(uID)
+	if err != nil {
+		return fmt.Errorf("in app#getTwoFactorHandler: %w", err)
+	}
+	if tf.Enabled {
+		left, err := app.models.TwoFactor.RecoveryCodesLeft(uID)
+		if err != nil {
+			return fmt.Errorf("in app#getTwoFactorHandler: %w", err)
+		}
+		isAdmin, err := app.models.Users.HasRole(uID, "admin")
+		if err != nil {
+			return fmt.Errorf("in app#getTwoFactorHandler: %w", err)
+		}
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.TwoFactorSettingsPage(
+				pages.TwoFactorSettingsViewModel{
+					RecoveryCodesLeft: left,
+					CanDisable:        !isAdmin,
+				},
+			),
+		)
+	}
+
+	required, err := app.models.TwoFactor.Required(uID)
+	if err != nil {
+		return fmt.Errorf("in app#getTwoFactorHandler: %w", err)
+	}
+	email, err := app.models.Users.GetEmail(uID)
+	if err != nil {
+		return fmt.Errorf("in app#getTwoFactorHandler: %w", err)
+	}
+	// New secret is generated on every visit, only the
+	// one shown most recently can be confirmed.
+	enrollment, err := app.services.TwoFactor.Enroll(email)
+	if err != nil {
+		return fmt.Errorf("in app#getTwoFactorHandler: %w", err)
+	}
+	if err := app.models.TwoFactor.SetPendingSecret(uID, enrollment.Secret); err != nil {
+		return fmt.Errorf("in app#getTwoFactorHandler: %w", err)
+	}
+	return views.Render(
+		c,
+		http.StatusOK,
+		pages.TwoFactorSetupPage(
+			pages.TwoFactorSetupViewModel{
+				Required: required,
+				QRCode:   enrollment.QRCode,
+				Secret:   enrollment.Secret,
+			},
+		),
+	)
+}
+
+// enableTwoFactorHandler confirms the enrollment with the first
+// code from the authenticator app and shows recovery codes.
+func (app *application) enableTwoFactorHandler(c echo.Context) error {
+	var input struct {
+		Code string `form:"code" validate:"required,numeric,len=6"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.TwoFactorConfirmForm("Code must have 6 digits."),
+		)
+	}
+
+	uID := c.Get("userID").(int)
+	tf, err := app.models.TwoFactor.Get(uID)
+	if err != nil {
+		return fmt.Errorf("in app#enableTwoFactorHandler: %w", err)
+	}
+	if tf.Enabled || tf.Secret == "" {
+		c.Response().Header().Set("HX-Location", "/users/2fa")
+		return c.NoContent(http.StatusOK)
+	}
+	step, ok := app.services.TwoFactor.Validate(tf.Secret, input.Code)
+	if !ok {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.TwoFactorConfirmForm("Code is not right, check the time on your device."),
+		)
+	}
+
+	codes, err := app.services.TwoFactor.RecoveryCodes()
+	if err != nil {
+		return fmt.Errorf("in app#enableTwoFactorHandler: %w", err)
+	}
+	if err := app.models.TwoFactor.Enable(uID, step, codes); err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			c.Response().Header().Set("HX-Location", "/users/2fa")
+			return c.NoContent(http.StatusOK)
+		}
+		return fmt.Errorf("in app#enableTwoFactorHandler: %w", err)
+	}
+	return views.Render(c, http.StatusOK, pages.TwoFactorRecoveryCodes(codes))
+}
+
+func (app *application) disableTwoFactorHandler(c echo.Context) error {
+	var input struct {
+		Password string `form:"password" validate:"required,max=64"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.TwoFactorDisableForm("Provide your current password."),
+		)
+	}
+
+	uID := c.Get("userID").(int)
+	isAdmin, err := app.models.Users.HasRole(uID, "admin")
+	if err != nil {
+		return fmt.Errorf("in app#disableTwoFactorHandler: %w", err)
+	}
+	if isAdmin {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.TwoFactorDisableForm("Administrators can not disable two-factor authentication."),
+		)
+	}
+	email, err := app.models.Users.GetEmail(uID)
+	if err != nil {
+		return fmt.Errorf("in app#disableTwoFactorHandler: %w", err)
+	}
+	u, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		return fmt.Errorf("in app#disableTwoFactorHandler: %w", err)
+	}
+	match, err := u.Password.Match(input.Password)
+	if err != nil {
+		return fmt.Errorf("in app#disableTwoFactorHandler: %w", err)
+	}
+	if !match {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.TwoFactorDisableForm("Password is not right."),
+		)
+	}
+
+	if err := app.models.TwoFactor.Disable(uID); err != nil {
+		return fmt.Errorf("in app#disableTwoFactorHandler: %w", err)
+	}
+	app.sessionManager.Put(
+		c.Request().Context(),
+		"alert",
+		components.AlertProps{
+			Title: "2FA disabled",
+			Text:  "Only the password is needed to log in now.",
+			Icon:  components.Warning,
+		},
+	)
+	c.Response().Header().Set("HX-Location", fmt.Sprintf("/users/%d", uID))
+	return c.NoContent(http.StatusOK)
+}
+
+func (app *application) getTwoFactorVerifyHandler(c echo.Context) error {
+	if app.pendingTwoFactorUserID(c) == 0 {
+		app.clearTwoFactorLogin(c)
+		return c.Redirect(http.StatusSeeOther, "/login")
+	}
+	return views.Render(c, http.StatusOK, pages.TwoFactorVerifyPage())
+}
+
+// verifyTwoFactorHandler is the second step of the login. Either
+// the code from the authenticator app or recovery code is accepted.
+func (app *application) verifyTwoFactorHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	uID := app.pendingTwoFactorUserID(c)
+	if uID == 0 {
+		app.clearTwoFactorLogin(c)
+		app.sessionManager.Put(
+			ctx,
+			"alert",
+			components.AlertProps{
+				Title: "Login expired",
+				Text:  "Log in again, please.",
+				Icon:  components.Error,
+			},
+		)
+		c.Response().Header().Set("HX-Location", "/login")
+		return c.NoContent(http.StatusOK)
+	}
+
+	var input struct {
+		Code string `form:"code" validate:"required,max=32"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return err
+	}
+	if err := c.Validate(&input); err != nil {
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.TwoFactorVerifyForm("Provide the code."),
+		)
+	}
+
+	attempts := app.sessionManager.GetInt(ctx, twoFactorAttemptsKey) + 1
+	app.sessionManager.Put(ctx, twoFactorAttemptsKey, attempts)
+	if attempts > maxTwoFactorAttempts {
+		app.clearTwoFactorLogin(c)
+		app.sessionManager.Put(
+			ctx,
+			"alert",
+			components.AlertProps{
+				Title: "Too many attempts",
+				Text:  "Log in again, please.",
+				Icon:  components.Error,
+			},
+		)
+		c.Response().Header().Set("HX-Location", "/login")
+		return c.NoContent(http.StatusOK)
+	}
+
+	email, err := app.models.Users.GetEmail(uID)
+	if err != nil {
+		return fmt.Errorf("in app#verifyTwoFactorHandler: %w", err)
+	}
+	u, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		return fmt.Errorf("in app#verifyTwoFactorHandler: %w", err)
+	}
+	ip := c.RealIP()
+	refusal, err := app.twoFactorRefusal(u, ip)
+	if err != nil {
+		return fmt.Errorf("in app#verifyTwoFactorHandler: %w", err)
+	}
+	if refusal != "" {
+		return views.Render(c, http.StatusOK, pages.TwoFactorVerifyForm(refusal))
+	}
+
+	ok, err := app.checkTwoFactorCode(uID, input.Code)
+	if err != nil {
+		return fmt.Errorf("in app#verifyTwoFactorHandler: %w", err)
+	}
+	if !ok {
+		app.recordLoginAttempt(data.LoginAttempt{
+			Email:  u.Email,
+			UserID: u.ID,
+			IP:     ip,
+			Reason: data.LoginWrongCode,
+		})
+		if err := app.lockAccountIfNeeded(u); err != nil {
+			app.logger.Error("app#verifyTwoFactorHandler-account-locking", "error", err.Error())
+		}
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.TwoFactorVerifyForm("Code is not right."),
+		)
+	}
+
+	app.recordLoginAttempt(data.LoginAttempt{
+		Email:   u.Email,
+		UserID:  u.ID,
+		IP:      ip,
+		Success: true,
+	})
+	app.clearTwoFactorLogin(c)
+	if err := app.logIn(c, uID); err != nil {
+		return fmt.Errorf("in app#verifyTwoFactorHandler: %w", err)
+	}
+	app.sessionManager.Put(
+		ctx,
+		"alert",
+		components.AlertProps{
+			Title: "Logged in",
+			Text:  "You have been successfully logged in!",
+			Icon:  components.Success,
+		},
+	)
+	c.Response().Header().Set("HX-Location", "/")
+	return c.NoContent(http.StatusOK)
+}
+
+// twoFactorRefusal returns message shown instead of checking the
+// code when the account is locked or it has to wait after failed
+// attempts, wrong codes are throttled like wrong passwords.
+func (app *application) twoFactorRefusal(u *data.User, ip string) (string, error) {
+	lockedUntil, err := app.models.Users.LockedUntil(u.ID)
+	if err != nil {
+		return "", fmt.Errorf("in app#twoFactorRefusal: %w", err)
+	}
+	if !lockedUntil.IsZero() {
+		app.recordLoginAttempt(data.LoginAttempt{
+			Email:  u.Email,
+			UserID: u.ID,
+			IP:     ip,
+			Reason: data.LoginLocked,
+		})
+		return "Account is temporarily locked, try again in " + waitMsg(time.Until(lockedUntil)) + " or reset your password.", nil
+	}
+	wait, err := app.loginWait(u.Email, ip)
+	if err != nil {
+		return "", fmt.Errorf("in app#twoFactorRefusal: %w", err)
+	}
+	if wait > 0 {
+		app.recordLoginAttempt(data.LoginAttempt{
+			Email:  u.Email,
+			UserID: u.ID,
+			IP:     ip,
+			Reason: data.LoginThrottled,
+		})
+		return "Too many failed attempts, try again in " + waitMsg(wait) + ".", nil
+	}
+	return "", nil
+}
+
+// checkTwoFactorCode accepts codes from the authenticator app once
+// per time step. Anything else is treated as a recovery code.
+func (app *application) checkTwoFactorCode(userID int, code string) (bool, error) {
+	tf, err := app.models.TwoFactor.Get(userID)
+	if err != nil {
+		return false, err
+	}
+	if !tf.Enabled {
+		return false, nil
+	}
+	if code = strings.TrimSpace(code); len(code) == 6 {
+		step, ok := app.services.TwoFactor.Validate(tf.Secret, code)
+		if !ok {
+			return false, nil
+		}
+		return app.models.TwoFactor.UseStep(userID, step)
+	}
+	return app.models.TwoFactor.UseRecoveryCode(userID, code)
+}
+
+// requireTwoFactorSetup keeps administrators without 2FA
+// on the setup page until they enable it.
+func (app *application) requireTwoFactorSetup(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("userID").(int)
+		if userID == 0 || twoFactorSetupPaths[c.Path()] {
+			return next(c)
+		}
+		required, err := app.models.TwoFactor.Required(userID)
+		if err != nil {
+			return fmt.Errorf("in app#requireTwoFactorSetup: %w", err)
+		}
+		if !required {
+			return next(c)
+		}
+		if isAPIRequest(c) {
+			return apiError(
+				c,
+				http.StatusForbidden,
+				"Enable two-factor authentication on /users/2fa first.",
+			)
+		}
+		if c.Get("HTMX").(bool) {
+			c.Response().Header().Set("HX-Location", "/users/2fa")
+			return c.NoContent(http.StatusOK)
+		}
+		return c.Redirect(http.StatusSeeOther, "/users/2fa")
+	}
+}
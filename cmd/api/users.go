@@ -4,23 +4,19 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/N0tR1CH/sad/internal/data"
-	"github.com/N0tR1CH/sad/internal/mailer"
+	"github.com/N0tR1CH/sad/internal/services"
 	"github.com/N0tR1CH/sad/views"
 	"github.com/N0tR1CH/sad/views/components"
 	"github.com/N0tR1CH/sad/views/pages"
 	"github.com/a-h/templ"
 	"github.com/go-playground/validator/v10"
-	"github.com/google/uuid"
-	"github.com/h2non/bimg"
 	"github.com/labstack/echo/v4"
 )
 
@@ -43,6 +39,10 @@ func (app *application) loginHandler(c echo.Context) error {
 }
 
 func (app *application) deauthenticateUserHandler(c echo.Context) error {
+	// Personal access tokens are revoked from the profile instead
+	if tokenAuthenticated(c) {
+		return c.NoContent(http.StatusForbidden)
+	}
 	var input struct {
 		ID string `param:"id" validate:"number"`
 	}
@@ -80,6 +80,7 @@ func (app *application) deauthenticateUserHandler(c echo.Context) error {
 	}
 
 	app.sessionManager.Remove(c.Request().Context(), "userID")
+	app.sessionManager.Remove(c.Request().Context(), sessionInfoKey)
 	c.Response().Header().Set("HX-Location", "/")
 	app.sessionManager.Put(
 		c.Request().Context(),
@@ -142,12 +143,47 @@ func (app *application) authenticateUserHandler(c echo.Context) error {
 		)
 	}
 
+	ip := c.RealIP()
+	wait, err := app.loginWait(input.Email, ip)
+	if err != nil {
+		app.logger.Error("app#authenticateUserHandler-login-wait", "error", err.Error())
+		return err
+	}
+	if wait > 0 {
+		app.recordLoginAttempt(data.LoginAttempt{
+			Email:  input.Email,
+			IP:     ip,
+			Reason: data.LoginThrottled,
+		})
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.LoginFormBody(
+				pages.LoginPageProps{
+					PageTitle:       "Auth Page",
+					PageDescription: "Provide your email and we will redirect you to correct action.",
+					EmailFieldProps: pages.EmailFieldProps{
+						IsInputWrong: false,
+						InputValue:   input.Email,
+						ErrMsg:       "Too many failed attempts, try again in " + waitMsg(wait) + ".",
+					},
+					Fields: nil,
+				},
+			),
+		)
+	}
+
 	u, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		app.logger.Error("app#authenticateUserHandler-user-retrieval", "error", err.Error())
 		if !errors.Is(err, data.ErrRecordNotFound) {
 			return err
 		}
+		app.recordLoginAttempt(data.LoginAttempt{
+			Email:  input.Email,
+			IP:     ip,
+			Reason: data.LoginUnknownEmail,
+		})
 
 		return views.Render(
 			c,
@@ -167,6 +203,36 @@ func (app *application) authenticateUserHandler(c echo.Context) error {
 		)
 	}
 
+	lockedUntil, err := app.models.Users.LockedUntil(u.ID)
+	if err != nil {
+		app.logger.Error("app#authenticateUserHandler-lock-retrieval", "error", err.Error())
+		return err
+	}
+	if !lockedUntil.IsZero() {
+		app.recordLoginAttempt(data.LoginAttempt{
+			Email:  input.Email,
+			UserID: u.ID,
+			IP:     ip,
+			Reason: data.LoginLocked,
+		})
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.LoginFormBody(
+				pages.LoginPageProps{
+					PageTitle:       "Auth Page",
+					PageDescription: "Provide your email and we will redirect you to correct action.",
+					EmailFieldProps: pages.EmailFieldProps{
+						IsInputWrong: false,
+						InputValue:   input.Email,
+						ErrMsg:       "Account is temporarily locked, try again in " + waitMsg(time.Until(lockedUntil)) + " or reset your password.",
+					},
+					Fields: nil,
+				},
+			),
+		)
+	}
+
 	match, err := u.Password.Match(input.Password)
 	if err != nil {
 		app.logger.Error("app#authenticateUserHandler-password-matching", "error", err.Error())
@@ -174,6 +240,15 @@ func (app *application) authenticateUserHandler(c echo.Context) error {
 	}
 
 	if !match {
+		app.recordLoginAttempt(data.LoginAttempt{
+			Email:  input.Email,
+			UserID: u.ID,
+			IP:     ip,
+			Reason: data.LoginWrongPassword,
+		})
+		if err := app.lockAccountIfNeeded(u); err != nil {
+			app.logger.Error("app#authenticateUserHandler-account-locking", "error", err.Error())
+		}
 		return views.Render(
 			c,
 			http.StatusOK,
@@ -192,11 +267,28 @@ func (app *application) authenticateUserHandler(c echo.Context) error {
 		)
 	}
 
-	if err := app.sessionManager.RenewToken(c.Request().Context()); err != nil {
+	tf, err := app.models.TwoFactor.Get(u.ID)
+	if err != nil {
+		app.logger.Error("app#authenticateUserHandler-two-factor-retrieval", "error", err.Error())
+		return err
+	}
+	// Success clears failures of the account, with 2FA it is
+	// recorded only after the second factor is verified
+	if tf.Enabled {
+		return app.startTwoFactorLogin(c, u.ID)
+	}
+
+	app.recordLoginAttempt(data.LoginAttempt{
+		Email:   input.Email,
+		UserID:  u.ID,
+		IP:      ip,
+		Success: true,
+	})
+
+	if err := app.logIn(c, u.ID); err != nil {
 		app.logger.Error("app#authenticateUserHandler-token-renewal", "error", err.Error())
 		return err
 	}
-	app.sessionManager.Put(c.Request().Context(), "userID", u.ID)
 
 	app.sessionManager.Put(
 		c.Request().Context(),
@@ -227,38 +319,6 @@ func (app *application) createUserHandler(c echo.Context) error {
 		Password string `form:"password" validate:"required,min=8,max=64,containsany=!@#?*,containsany=ABCDEFGHIJKLMNOPQRSTUVWXYZ,containsany=123456789"`
 	}
 
-	var resPath string
-	file, err := c.FormFile("avatar")
-	if file != nil {
-		if err != nil {
-			return err
-		}
-		src, err := file.Open()
-		if err != nil {
-			return err
-		}
-		defer func() {
-			closeErr := src.Close()
-			app.logger.Error("closing file", "error", closeErr.Error())
-		}()
-		fileBytes, err := io.ReadAll(src)
-		if err != nil {
-			return err
-		}
-		webpImgBytes, err := bimg.NewImage(fileBytes).Convert(bimg.WEBP)
-		resPath = fmt.Sprintf("/public/avatars/%s.webp", uuid.NewString())
-		filepath := fmt.Sprintf("cmd/web%s", resPath)
-		f, err := os.Create(filepath)
-		if err != nil {
-			return err
-		}
-		defer func() {
-			_, err = f.Write(webpImgBytes)
-		}()
-	}
-
-	app.logger.Info("avatar!!!", "respath", resPath)
-
 	if err := c.Bind(&input); err != nil {
 		return views.Render(
 			c,
@@ -300,7 +360,6 @@ func (app *application) createUserHandler(c echo.Context) error {
 	u := &data.User{
 		Email:     input.Email,
 		Name:      input.Username,
-		AvatarSrc: resPath,
 		Activated: false,
 	}
 	if err := u.Password.Set(input.Password); err != nil {
@@ -322,7 +381,38 @@ func (app *application) createUserHandler(c echo.Context) error {
 		)
 	}
 
+	// Avatar is stored only once the rest of the form is valid
+	avatarSrc, err := app.saveAvatar(c)
+	if err != nil {
+		// Username was valid, only password has to be typed again
+		app.sessionManager.Put(c.Request().Context(), "usernameRight", true)
+		return views.Render(
+			c,
+			http.StatusOK,
+			pages.LoginFormBody(
+				pages.LoginPageProps{
+					PageTitle:       "Register",
+					PageDescription: "Insert data in order to create new account.",
+					EmailFieldProps: pages.EmailFieldProps{
+						IsInputWrong: false,
+						InputValue:   input.Email,
+					},
+					Fields: pages.RegisterFields(
+						pages.RegisterFieldsProps{
+							Username:     input.Username,
+							AvatarErrMsg: avatarErrMsg(err),
+						},
+					),
+				},
+			),
+		)
+	}
+	u.AvatarSrc = avatarSrc
+
 	if err := app.models.Users.Insert(u); err != nil {
+		if avatarSrc != "" {
+			_ = app.services.Avatars.Remove(avatarSrc)
+		}
 		return views.Render(
 			c,
 			http.StatusOK,
@@ -341,12 +431,7 @@ func (app *application) createUserHandler(c echo.Context) error {
 		)
 	}
 
-	t, err := app.models.Tokens.New(
-		u.ID,
-		24*time.Hour,
-		data.TokenType(data.TokenTypeActivation),
-	)
-	if err != nil {
+	if err := app.sendActivationEmail(u); err != nil {
 		app.logger.Error("TokenGeneration", "error", err.Error())
 		return views.Render(
 			c,
@@ -366,20 +451,6 @@ func (app *application) createUserHandler(c echo.Context) error {
 		)
 	}
 
-	app.startBackgroundJob(func() {
-		if err := app.mailer.Send(
-			u.Email,
-			mailer.MailSubject(),
-			mailer.PlainBody(u.ID, t.PlainText),
-			mailer.HtmlBody(u.ID, t.PlainText),
-		); err != nil {
-			app.logger.Error(
-				"user#create while sending email",
-				"Err", err.Error(),
-			)
-		}
-	})
-
 	c.Response().Header().Set("HX-Push-Url", "/")
 	c.Response().Header().Set("HX-Retarget", "#app-main-container")
 	c.Response().Header().Set("HX-Reswap", "innerHTML")
@@ -449,7 +520,7 @@ func (app *application) validateUserEmailHandler(c echo.Context) error {
 						InputValue:   input.Email,
 						ErrMsg:       errMsg,
 					},
-					Fields: pages.RegisterFields(),
+					Fields: pages.RegisterFields(pages.RegisterFieldsProps{}),
 				},
 			),
 		)
@@ -768,7 +839,7 @@ func (app *application) getUserAvatarHandler(c echo.Context) error {
 	}
 	var t templ.Component
 	if src != "" {
-		t = components.AvatarImg(src)
+		t = components.AvatarImg(services.AvatarVariant(src, 64))
 	} else {
 		t = components.AvatarPlaceHolder()
 	}
@@ -815,7 +886,7 @@ func (app *application) getUserHandler(c echo.Context) error {
 	vm := pages.UserPageViewModel{
 		Id:          u.ID,
 		Name:        u.Name,
-		AvatarSrc:   u.AvatarSrc,
+		AvatarSrc:   services.AvatarVariant(u.AvatarSrc, 256),
 		Description: u.Description,
 		Activated:   u.Activated,
 	}
@@ -1053,5 +1124,8 @@ func (app *application) banUserHandler(c echo.Context) error {
 	if err := app.models.Users.Ban(uId); err != nil {
 		return fmt.Errorf("in app#banUserHandler while banning user: %w", err)
 	}
+	if err := app.destroyUserSessions(uId); err != nil {
+		return fmt.Errorf("in app#banUserHandler while logging user out: %w", err)
+	}
 	return c.NoContent(http.StatusOK)
 }
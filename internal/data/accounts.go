@@ -0,0 +1,501 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PersonalData is everything the site stores about the user,
+// it is exported as data.json of the archive.
+type PersonalData struct {
+	Profile           PersonalProfile            `json:"profile"`
+	Discussions       []PersonalDiscussion       `json:"discussions"`
+	Comments          []PersonalComment          `json:"comments"`
+	CommentUpvotes    []PersonalCommentUpvote    `json:"comment_upvotes"`
+	DiscussionUpvotes []PersonalDiscussionUpvote `json:"discussion_upvotes"`
+	ReportsFiled      []PersonalReport           `json:"reports_filed"`
+	ExportedAt        time.Time                  `json:"exported_at"`
+	DeletionScheduled *time.Time                 `json:"deletion_scheduled_at"`
+	TwoFactorEnabled  bool                       `json:"two_factor_enabled"`
+}
+
+type PersonalProfile struct {
+	ID           int       `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	PendingEmail string    `json:"pending_email,omitempty"`
+	Description  string    `json:"description"`
+	AvatarSrc    string    `json:"avatar_src,omitempty"`
+	Activated    bool      `json:"activated"`
+	Role         string    `json:"role"`
+}
+
+type PersonalDiscussion struct {
+	ID          int       `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Url         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Category    string    `json:"category"`
+	NumUpvotes  int       `json:"num_upvotes"`
+}
+
+type PersonalComment struct {
+	ID           int        `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DiscussionID int        `json:"discussion_id"`
+	ParentID     *int       `json:"parent_id"`
+	Content      string     `json:"content"`
+	EditedAt     *time.Time `json:"edited_at"`
+	// Revisions are previous contents of the comment, the oldest first.
+	Revisions []string `json:"revisions"`
+}
+
+type PersonalCommentUpvote struct {
+	CommentID int `json:"comment_id"`
+	// Value is 1 for upvote and -1 for downvote.
+	Value int `json:"value"`
+}
+
+type PersonalDiscussionUpvote struct {
+	DiscussionID int       `json:"discussion_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type PersonalReport struct {
+	ID             int       `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ReportedUserID *int      `json:"reported_user_id"`
+	DiscussionID   *int      `json:"discussion_id"`
+	CommentID      *int      `json:"comment_id"`
+	Reason         string    `json:"reason"`
+}
+
+type AccountModel struct {
+	DB *sql.DB
+}
+
+// PersonalData collects data of the user for the export.
+func (am AccountModel) PersonalData(userID int) (pd *PersonalData, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// Sections are read from the same snapshot of the database
+	tx, err := am.DB.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("in AccountModel#PersonalData: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	pd = &PersonalData{
+		Discussions:       []PersonalDiscussion{},
+		Comments:          []PersonalComment{},
+		CommentUpvotes:    []PersonalCommentUpvote{},
+		DiscussionUpvotes: []PersonalDiscussionUpvote{},
+		ReportsFiled:      []PersonalReport{},
+		ExportedAt:        time.Now().UTC(),
+	}
+	q := `
+		SELECT
+			u.id,
+			u.created_at,
+			u.updated_at,
+			u.name,
+			u.email,
+			COALESCE(u.pending_email, ''),
+			u.description,
+			COALESCE(u.avatar_src, ''),
+			u.activated,
+			r.name,
+			u.deletion_scheduled_at,
+			u.totp_enabled
+		FROM users u
+			INNER JOIN roles r ON u.role_id = r.id
+		WHERE u.id = $1
+	`
+	var deletionScheduledAt sql.NullTime
+	p := &pd.Profile
+	if err := tx.QueryRowContext(ctx, q, &userID).Scan(
+		&p.ID,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.Name,
+		&p.Email,
+		&p.PendingEmail,
+		&p.Description,
+		&p.AvatarSrc,
+		&p.Activated,
+		&p.Role,
+		&deletionScheduledAt,
+		&pd.TwoFactorEnabled,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("in AccountModel#PersonalData: %w", err)
+		}
+	}
+	if deletionScheduledAt.Valid {
+		pd.DeletionScheduled = &deletionScheduledAt.Time
+	}
+
+	q = `
+		SELECT
+			d.id,
+			d.created_at,
+			d.updated_at,
+			d.url,
+			d.title,
+			d.description,
+			COALESCE(c.name, ''),
+			d.num_upvotes
+		FROM discussions d
+			LEFT JOIN categories c ON d.category_id = c.id
+		WHERE d.user_id = $1
+		ORDER BY d.id
+	`
+	if err := queryAll(ctx, tx, q, userID, func(rows *sql.Rows) error {
+		var d PersonalDiscussion
+		if err := rows.Scan(
+			&d.ID,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+			&d.Url,
+			&d.Title,
+			&d.Description,
+			&d.Category,
+			&d.NumUpvotes,
+		); err != nil {
+			return err
+		}
+		pd.Discussions = append(pd.Discussions, d)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in AccountModel#PersonalData while reading discussions: %w", err)
+	}
+
+	q = `
+		SELECT
+			c.id,
+			c.created_at,
+			c.updated_at,
+			c.discussion_id,
+			c.parent_id,
+			c.content,
+			c.edited_at,
+			COALESCE(
+				(
+					SELECT jsonb_agg(r.content ORDER BY r.id)
+					FROM comment_revisions r
+					WHERE r.comment_id = c.id
+				),
+				'[]'::JSONB
+			)
+		FROM comments c
+		WHERE c.user_id = $1
+		ORDER BY c.id
+	`
+	if err := queryAll(ctx, tx, q, userID, func(rows *sql.Rows) error {
+		var (
+			cm        PersonalComment
+			parentID  sql.NullInt64
+			editedAt  sql.NullTime
+			revisions []byte
+		)
+		if err := rows.Scan(
+			&cm.ID,
+			&cm.CreatedAt,
+			&cm.UpdatedAt,
+			&cm.DiscussionID,
+			&parentID,
+			&cm.Content,
+			&editedAt,
+			&revisions,
+		); err != nil {
+			return err
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			cm.ParentID = &id
+		}
+		if editedAt.Valid {
+			cm.EditedAt = &editedAt.Time
+		}
+		if err := json.Unmarshal(revisions, &cm.Revisions); err != nil {
+			return err
+		}
+		pd.Comments = append(pd.Comments, cm)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in AccountModel#PersonalData while reading comments: %w", err)
+	}
+
+	q = "SELECT comment_id, value FROM upvotes WHERE user_id = $1 ORDER BY id"
+	if err := queryAll(ctx, tx, q, userID, func(rows *sql.Rows) error {
+		var up PersonalCommentUpvote
+		if err := rows.Scan(&up.CommentID, &up.Value); err != nil {
+			return err
+		}
+		pd.CommentUpvotes = append(pd.CommentUpvotes, up)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in AccountModel#PersonalData while reading upvotes: %w", err)
+	}
+
+	q = `
+		SELECT discussion_id, created_at
+		FROM discussion_upvotes
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	if err := queryAll(ctx, tx, q, userID, func(rows *sql.Rows) error {
+		var up PersonalDiscussionUpvote
+		if err := rows.Scan(&up.DiscussionID, &up.CreatedAt); err != nil {
+			return err
+		}
+		pd.DiscussionUpvotes = append(pd.DiscussionUpvotes, up)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in AccountModel#PersonalData while reading discussion upvotes: %w", err)
+	}
+
+	q = `
+		SELECT id, created_at, reported_user_id, discussion_id, comment_id, reason
+		FROM reports
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	if err := queryAll(ctx, tx, q, userID, func(rows *sql.Rows) error {
+		var (
+			r                                       PersonalReport
+			reportedUserID, discussionID, commentID sql.NullInt64
+		)
+		if err := rows.Scan(
+			&r.ID,
+			&r.CreatedAt,
+			&reportedUserID,
+			&discussionID,
+			&commentID,
+			&r.Reason,
+		); err != nil {
+			return err
+		}
+		// Reported account could have been deleted since
+		if reportedUserID.Valid {
+			id := int(reportedUserID.Int64)
+			r.ReportedUserID = &id
+		}
+		if discussionID.Valid {
+			id := int(discussionID.Int64)
+			r.DiscussionID = &id
+		}
+		if commentID.Valid {
+			id := int(commentID.Int64)
+			r.CommentID = &id
+		}
+		pd.ReportsFiled = append(pd.ReportsFiled, r)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("in AccountModel#PersonalData while reading reports: %w", err)
+	}
+
+	return pd, nil
+}
+
+// queryAll calls scan for every row returned by the query.
+func queryAll(
+	ctx context.Context,
+	tx *sql.Tx,
+	query string,
+	userID int,
+	scan func(rows *sql.Rows) error,
+) (err error) {
+	rows, err := tx.QueryContext(ctx, query, &userID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rcErr := rows.Close()
+		if rcErr != nil && err == nil {
+			err = rcErr
+		}
+	}()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ScheduleDeletion marks account of the user to be deleted at the
+// given time. Already scheduled deletion is not postponed, in that
+// case ErrEditConflict is returned.
+func (am AccountModel) ScheduleDeletion(userID int, at time.Time) error {
+	q := `
+		UPDATE users
+		SET
+			deletion_scheduled_at = $1,
+			updated_at = current_timestamp,
+			version = version + 1
+		WHERE id = $2 AND deletion_scheduled_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := am.DB.ExecContext(ctx, q, &at, &userID)
+	if err != nil {
+		return fmt.Errorf("in AccountModel#ScheduleDeletion: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in AccountModel#ScheduleDeletion: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
+
+// CancelDeletion keeps the account, ErrRecordNotFound is returned
+// when no deletion was scheduled.
+func (am AccountModel) CancelDeletion(userID int) error {
+	q := `
+		UPDATE users
+		SET
+			deletion_scheduled_at = NULL,
+			updated_at = current_timestamp,
+			version = version + 1
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := am.DB.ExecContext(ctx, q, &userID)
+	if err != nil {
+		return fmt.Errorf("in AccountModel#CancelDeletion: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in AccountModel#CancelDeletion: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeletionScheduledAt returns zero time when the deletion
+// of the account is not scheduled.
+func (am AccountModel) DeletionScheduledAt(userID int) (time.Time, error) {
+	var at sql.NullTime
+	q := "SELECT deletion_scheduled_at FROM users WHERE id = $1"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := am.DB.QueryRowContext(ctx, q, &userID).Scan(&at); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, ErrRecordNotFound
+		default:
+			return time.Time{}, fmt.Errorf("in AccountModel#DeletionScheduledAt: %w", err)
+		}
+	}
+	return at.Time, nil
+}
+
+// DueForDeletion lists ids of users whose grace period is over.
+func (am AccountModel) DueForDeletion() (ids []int, err error) {
+	q := `
+		SELECT id
+		FROM users
+		WHERE deletion_scheduled_at <= current_timestamp
+		ORDER BY deletion_scheduled_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := am.DB.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("in AccountModel#DueForDeletion: %w", err)
+	}
+	defer func() {
+		rcErr := rows.Close()
+		if rcErr != nil && err == nil {
+			err = rcErr
+		}
+	}()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("in AccountModel#DueForDeletion: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("in AccountModel#DueForDeletion: %w", err)
+	}
+	return ids, nil
+}
+
+// Delete removes the account whose deletion is due. Discussions,
+// comments, upvotes and reports filed by or against the user are
+// kept without them, everything else is removed together with the
+// user. Upvotes of discussions go away with the user, so their
+// counters are decreased first. Avatar of the user is returned, so it
+// can be removed from the storage.
+func (am AccountModel) Delete(userID int) (avatarSrc string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tx, err := am.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("in AccountModel#Delete: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Attempts would keep the email after the user is gone,
+	// so they are removed first, while the user id is still set.
+	q := `
+		DELETE FROM login_attempts
+		WHERE user_id = $1 OR email = (SELECT email FROM users WHERE id = $1)
+	`
+	if _, err = tx.ExecContext(ctx, q, &userID); err != nil {
+		return "", fmt.Errorf("in AccountModel#Delete: %w", err)
+	}
+	q = `
+		UPDATE discussions SET num_upvotes = num_upvotes - 1
+		WHERE id IN (SELECT discussion_id FROM discussion_upvotes WHERE user_id = $1)
+	`
+	if _, err = tx.ExecContext(ctx, q, &userID); err != nil {
+		return "", fmt.Errorf("in AccountModel#Delete: %w", err)
+	}
+	q = `
+		DELETE FROM users
+		WHERE id = $1 AND deletion_scheduled_at <= current_timestamp
+		RETURNING COALESCE(avatar_src, '')
+	`
+	if err = tx.QueryRowContext(ctx, q, &userID).Scan(&avatarSrc); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrRecordNotFound
+			return "", err
+		}
+		return "", fmt.Errorf("in AccountModel#Delete: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("in AccountModel#Delete: %w", err)
+	}
+	return avatarSrc, nil
+}
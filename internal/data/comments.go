@@ -6,10 +6,83 @@ import (
 	"errors"
 	"fmt"
 	"time"
+)
+
+// CommentsPerPage is the number of comments returned by GetAllWithUser
+// and GetAllChildren, and the number of top level comments of GetThread.
+const CommentsPerPage = 10
+
+// MaxThreadDepth is the number of levels of the comment tree loaded
+// by GetThread, deeper replies are loaded as threads of their own.
+const MaxThreadDepth = 4
+
+// RepliesPerComment is the number of replies to each comment loaded
+// by GetThread, the rest is loaded as thread of the comment.
+const RepliesPerComment = 3
+
+// commentSortColumns are selected from comments aliased c
+// for the ORDER BY clause of the sort.
+const commentSortColumns = `
+	c.id,
+	c.created_at,
+	c.score,
+	(SELECT COUNT(*) FROM upvotes up WHERE up.comment_id=c.id AND up.value > 0) AS num_upvotes,
+	(SELECT COUNT(*) FROM upvotes up WHERE up.comment_id=c.id AND up.value < 0) AS num_downvotes,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_id=c.id) AS num_replies`
+
+// CommentSort determines order in which comments are listed.
+type CommentSort string
 
-	"github.com/jackc/pgx/v5/pgconn"
+const (
+	// CommentSortTop orders comments by score.
+	CommentSortTop CommentSort = "top"
+	// CommentSortNew orders comments from the newest.
+	CommentSortNew CommentSort = "new"
+	// CommentSortOld orders comments from the oldest.
+	CommentSortOld CommentSort = "old"
+	// CommentSortControversial orders comments by the number of
+	// votes, the more evenly they are split between upvotes and
+	// downvotes the higher the comment is.
+	CommentSortControversial CommentSort = "controversial"
 )
 
+// ParseCommentSort returns sort matching the given value.
+// Unknown values fall back to CommentSortTop.
+func ParseCommentSort(value string) CommentSort {
+	switch cs := CommentSort(value); cs {
+	case CommentSortTop, CommentSortNew, CommentSortOld, CommentSortControversial:
+		return cs
+	default:
+		return CommentSortTop
+	}
+}
+
+// orderBy returns ORDER BY clause of the sort, ids break ties
+// so pages do not overlap.
+func (cs CommentSort) orderBy() string {
+	switch cs {
+	case CommentSortNew:
+		return "c.created_at DESC, c.id DESC"
+	case CommentSortOld:
+		return "c.created_at ASC, c.id ASC"
+	case CommentSortControversial:
+		// Number of votes raised to the ratio of the minority to the
+		// majority, comments voted only one way are not controversial.
+		return `CASE
+				WHEN c.num_upvotes = 0 OR c.num_downvotes = 0 THEN 0
+				ELSE POWER(
+					c.num_upvotes + c.num_downvotes,
+					LEAST(c.num_upvotes, c.num_downvotes)::FLOAT /
+						GREATEST(c.num_upvotes, c.num_downvotes)
+				)
+			END DESC,
+			c.num_replies DESC,
+			c.id DESC`
+	default:
+		return "c.score DESC, c.id DESC"
+	}
+}
+
 type Comment struct {
 	ID           int
 	CreatedAt    time.Time
@@ -19,11 +92,49 @@ type Comment struct {
 	Content      string
 	U            User
 	NumUpvotes   int
-	ParentId     int
+	NumDownvotes int
+	// Score is the number of upvotes less the number of downvotes.
+	Score    int
+	ParentId int
+	// ViewerVote is the vote of the user the comments were loaded for,
+	// 1 for upvote, -1 for downvote and 0 when not voted.
+	ViewerVote int
+	// EditedAt is zero unless the content was edited.
+	EditedAt time.Time
+	// Deleted comment is a tombstone without content and author,
+	// it is kept so the replies stay in the tree.
+	Deleted bool
+	// NumReplies is the number of direct replies, including
+	// the ones not loaded.
+	NumReplies int
+	// Depth is the level of the comment in the thread loaded
+	// by GetThread, its top level comments are at depth 0.
+	Depth   int
+	Replies Comments
 }
 
 type Comments []Comment
 
+// CommentThread is a page of comments with replies nested
+// up to MaxThreadDepth levels.
+type CommentThread struct {
+	Comments Comments
+	// Left is the number of top level comments on the following pages.
+	Left int
+	// Until is id of the newest comment of the first page, following
+	// pages skip newer comments so they do not shift.
+	Until int
+}
+
+// CommentRevision is content of the comment before it was edited.
+type CommentRevision struct {
+	ID int
+	// CreatedAt is the time the content was replaced.
+	CreatedAt time.Time
+	CommentId int
+	Content   string
+}
+
 type CommentModel struct {
 	DB *sql.DB
 }
@@ -68,21 +179,296 @@ func (cm CommentModel) Insert(c *Comment) error {
 	return nil
 }
 
-func (cm CommentModel) Upvote(userId, commentId int) error {
-	q := "INSERT INTO upvotes (user_id, comment_id) VALUES($1, $2)"
-	args := []any{&userId, &commentId}
+// Vote sets vote of the user on the comment, value is 1 for upvote
+// and -1 for downvote. Voting the same way again retracts the vote.
+// Score of the comment is updated in the same transaction and
+// returned together with the vote of the user, 0 when retracted.
+// ErrRecordNotFound is returned when the comment does not exist
+// or is deleted.
+func (cm CommentModel) Vote(userId, commentId, value int) (score, vote int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := cm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("in CommentModel#Vote: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Locking the comment serializes votes on it,
+	// so the previous vote can not change meanwhile.
+	q := "SELECT score FROM comments WHERE id=$1 AND deleted_at IS NULL FOR UPDATE"
+	if err = tx.QueryRowContext(ctx, q, &commentId).Scan(&score); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrRecordNotFound
+			return 0, 0, err
+		}
+		return 0, 0, fmt.Errorf("in CommentModel#Vote: %w", err)
+	}
+	var prev int
+	q = "SELECT value FROM upvotes WHERE user_id=$1 AND comment_id=$2"
+	if err = tx.QueryRowContext(ctx, q, &userId, &commentId).Scan(&prev); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, fmt.Errorf("in CommentModel#Vote: %w", err)
+		}
+	}
+
+	switch prev {
+	case value:
+		q = "DELETE FROM upvotes WHERE user_id=$1 AND comment_id=$2"
+		_, err = tx.ExecContext(ctx, q, &userId, &commentId)
+		vote = 0
+	case 0:
+		q = "INSERT INTO upvotes (user_id, comment_id, value) VALUES ($1, $2, $3)"
+		_, err = tx.ExecContext(ctx, q, &userId, &commentId, &value)
+		vote = value
+	default:
+		q = "UPDATE upvotes SET value=$3 WHERE user_id=$1 AND comment_id=$2"
+		_, err = tx.ExecContext(ctx, q, &userId, &commentId, &value)
+		vote = value
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("in CommentModel#Vote: %w", err)
+	}
+
+	q = "UPDATE comments SET score = score + $1 WHERE id=$2 RETURNING score"
+	delta := vote - prev
+	if err = tx.QueryRowContext(ctx, q, &delta, &commentId).Scan(&score); err != nil {
+		return 0, 0, fmt.Errorf("in CommentModel#Vote: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("in CommentModel#Vote: %w", err)
+	}
+	return score, vote, nil
+}
+
+// ViewerVote returns vote of the user on the comment,
+// 0 when the user has not voted.
+func (cm CommentModel) ViewerVote(userId, commentId int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var vote int
+	if err := cm.DB.QueryRowContext(
+		ctx,
+		"SELECT COALESCE(SUM(value), 0) FROM upvotes WHERE user_id=$1 AND comment_id=$2",
+		&userId,
+		&commentId,
+	).Scan(&vote); err != nil {
+		return 0, fmt.Errorf("in CommentModel#ViewerVote: %w", err)
+	}
+	return vote, nil
+}
+
+// GetDiscussionID returns id of the discussion the comment belongs to.
+// ErrRecordNotFound is returned when the comment does not exist.
+func (cm CommentModel) GetDiscussionID(id int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var discussionId int
+	if err := cm.DB.QueryRowContext(
+		ctx,
+		"SELECT discussion_id FROM comments WHERE id=$1",
+		&id,
+	).Scan(&discussionId); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, fmt.Errorf("in CommentModel#GetDiscussionID: %w", err)
+		}
+	}
+	return discussionId, nil
+}
+
+// Get returns the comment together with its author.
+func (cm CommentModel) Get(id int) (*Comment, error) {
+	q := `
+		SELECT
+			c.id,
+			c.created_at,
+			c.updated_at,
+			COALESCE(c.user_id, 0),
+			c.discussion_id,
+			c.content,
+			COALESCE(c.parent_id, 0),
+			COALESCE(u.name, ''),
+			COALESCE(u.avatar_src, ''),
+			(SELECT COUNT(*) FROM upvotes WHERE comment_id = c.id AND value > 0),
+			(SELECT COUNT(*) FROM upvotes WHERE comment_id = c.id AND value < 0),
+			c.score,
+			c.edited_at,
+			c.deleted_at IS NOT NULL
+		FROM comments c
+			LEFT JOIN users u ON c.user_id=u.id
+		WHERE c.id=$1
+	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	if _, err := cm.DB.ExecContext(ctx, q, args...); err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Message == `duplicate key value violates unique constraint "upvotes_user_id_comment_id_key"` {
-			return fmt.Errorf("user can upvote comment only once: %w", ErrUniquenessViolation)
+	var (
+		c        Comment
+		editedAt sql.NullTime
+	)
+	if err := cm.DB.QueryRowContext(ctx, q, &id).Scan(
+		&c.ID,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.UserId,
+		&c.DiscussionId,
+		&c.Content,
+		&c.ParentId,
+		&c.U.Name,
+		&c.U.AvatarSrc,
+		&c.NumUpvotes,
+		&c.NumDownvotes,
+		&c.Score,
+		&editedAt,
+		&c.Deleted,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("in CommentModel#Get: %w", err)
 		}
-		return fmt.Errorf("in commentModel#upvote: %w", err)
+	}
+	c.EditedAt = editedAt.Time
+	return &c, nil
+}
+
+// Update replaces content of the comment, the previous
+// content is stored as its revision. ErrRecordNotFound is
+// returned when the comment does not exist or is deleted.
+func (cm CommentModel) Update(c *Comment) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := cm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("in CommentModel#Update: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q := `
+		INSERT INTO comment_revisions (comment_id, content)
+		SELECT id, content
+		FROM comments
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	res, err := tx.ExecContext(ctx, q, &c.ID)
+	if err != nil {
+		return fmt.Errorf("in CommentModel#Update: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in CommentModel#Update: %w", err)
+	}
+	if rowsAffected == 0 {
+		err = ErrRecordNotFound
+		return err
+	}
+
+	q = `
+		UPDATE comments
+		SET content = $1, edited_at = current_timestamp, updated_at = current_timestamp
+		WHERE id = $2
+		RETURNING updated_at, edited_at
+	`
+	if err = tx.QueryRowContext(ctx, q, &c.Content, &c.ID).Scan(
+		&c.UpdatedAt,
+		&c.EditedAt,
+	); err != nil {
+		return fmt.Errorf("in CommentModel#Update: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("in CommentModel#Update: %w", err)
 	}
 	return nil
 }
 
+// Delete turns the comment into a tombstone. Content, author and
+// revisions are removed while replies and upvotes are kept.
+// ErrRecordNotFound is returned when the comment does not exist
+// or is deleted already.
+func (cm CommentModel) Delete(id int) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := cm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("in CommentModel#Delete: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q := `
+		UPDATE comments
+		SET content = '', user_id = NULL, deleted_at = current_timestamp
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	res, err := tx.ExecContext(ctx, q, &id)
+	if err != nil {
+		return fmt.Errorf("in CommentModel#Delete: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in CommentModel#Delete: %w", err)
+	}
+	if rowsAffected == 0 {
+		err = ErrRecordNotFound
+		return err
+	}
+	q = "DELETE FROM comment_revisions WHERE comment_id = $1"
+	if _, err = tx.ExecContext(ctx, q, &id); err != nil {
+		return fmt.Errorf("in CommentModel#Delete: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("in CommentModel#Delete: %w", err)
+	}
+	return nil
+}
+
+// Revisions returns previous contents of the comment, the latest first.
+func (cm CommentModel) Revisions(id int) (revs []CommentRevision, err error) {
+	q := `
+		SELECT id, created_at, comment_id, content
+		FROM comment_revisions
+		WHERE comment_id = $1
+		ORDER BY id DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := cm.DB.QueryContext(ctx, q, &id)
+	if err != nil {
+		return nil, fmt.Errorf("in CommentModel#Revisions: %w", err)
+	}
+	defer func() {
+		rcErr := rows.Close()
+		if rcErr != nil && err == nil {
+			err = rcErr
+		}
+	}()
+	for rows.Next() {
+		var r CommentRevision
+		if err := rows.Scan(&r.ID, &r.CreatedAt, &r.CommentId, &r.Content); err != nil {
+			return nil, fmt.Errorf("in CommentModel#Revisions: %w", err)
+		}
+		revs = append(revs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("in CommentModel#Revisions: %w", err)
+	}
+	return revs, nil
+}
+
 func (cm CommentModel) GetAllChildren(parentId, page int) (
 	comms Comments,
 	numCurrComms int,
@@ -93,24 +479,29 @@ func (cm CommentModel) GetAllChildren(parentId, page int) (
 			c.id,
 			c.created_at,
 			c.updated_at,
-			c.user_id,
+			COALESCE(c.user_id, 0),
 			c.discussion_id,
 			c.content,
 			c.parent_id,
-			u.name,
-			u.avatar_src,
-			COUNT(up.id)
+			COALESCE(u.name, ''),
+			COALESCE(u.avatar_src, ''),
+			COUNT(up.id) FILTER (WHERE up.value > 0),
+			COUNT(up.id) FILTER (WHERE up.value < 0),
+			c.score,
+			c.edited_at,
+			c.deleted_at IS NOT NULL
 		FROM comments c
-			INNER JOIN users u ON c.user_id=u.id
+			LEFT JOIN users u ON c.user_id=u.id
 			LEFT JOIN upvotes up ON up.comment_id=c.id
-		WHERE c.parent_id=$1 OR $1=0
+		WHERE c.parent_id=$1
 		GROUP BY c.id, u.id
-		ORDER BY c.created_at DESC
-		LIMIT 10
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT $3
 		OFFSET $2
 	`
-	offset := (page - 1) * 10
-	args := []any{&parentId, &offset}
+	offset := (page - 1) * CommentsPerPage
+	limit := CommentsPerPage
+	args := []any{&parentId, &offset, &limit}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	rows, err := cm.DB.QueryContext(ctx, q, args...)
@@ -127,7 +518,10 @@ func (cm CommentModel) GetAllChildren(parentId, page int) (
 		}
 	}()
 	for rows.Next() {
-		var c Comment
+		var (
+			c        Comment
+			editedAt sql.NullTime
+		)
 		if err := rows.Scan(
 			&c.ID,
 			&c.CreatedAt,
@@ -139,12 +533,17 @@ func (cm CommentModel) GetAllChildren(parentId, page int) (
 			&c.U.Name,
 			&c.U.AvatarSrc,
 			&c.NumUpvotes,
+			&c.NumDownvotes,
+			&c.Score,
+			&editedAt,
+			&c.Deleted,
 		); err != nil {
 			return comms, 0, fmt.Errorf(
 				"in CommentModel#GetAllChildren while while mapping fields: %w",
 				err,
 			)
 		}
+		c.EditedAt = editedAt.Time
 		comms = append(comms, c)
 	}
 
@@ -155,7 +554,7 @@ func (cm CommentModel) GetAllChildren(parentId, page int) (
 	).Scan(&commsCount); err != nil {
 		return nil, 0, err
 	}
-	numCurrComms = commsCount - ((page-1)*10 + len(comms))
+	numCurrComms = commsCount - ((page-1)*CommentsPerPage + len(comms))
 	return comms, numCurrComms, nil
 }
 
@@ -165,23 +564,28 @@ func (cm CommentModel) GetAllWithUser(discussionId int, page int) (Comments, int
 			c.id,
 			c.created_at,
 			c.updated_at,
-			c.user_id,
+			COALESCE(c.user_id, 0),
 			c.discussion_id,
 			c.content,
-			u.name,
-			u.avatar_src,
-			COUNT(up.id)
+			COALESCE(u.name, ''),
+			COALESCE(u.avatar_src, ''),
+			COUNT(up.id) FILTER (WHERE up.value > 0),
+			COUNT(up.id) FILTER (WHERE up.value < 0),
+			c.score,
+			c.edited_at,
+			c.deleted_at IS NOT NULL
 		FROM comments c
-			INNER JOIN users u ON c.user_id=u.id
+			LEFT JOIN users u ON c.user_id=u.id
 			LEFT JOIN upvotes up ON up.comment_id=c.id
 		WHERE (c.discussion_id=$1 OR $1=0) AND c.parent_id IS NULL
 		GROUP BY c.id, u.id
-		ORDER BY c.created_at DESC
-		LIMIT 10
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT $3
 		OFFSET $2
 	`
-	offset := (page - 1) * 10
-	args := []any{&discussionId, &offset}
+	offset := (page - 1) * CommentsPerPage
+	limit := CommentsPerPage
+	args := []any{&discussionId, &offset, &limit}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	rows, err := cm.DB.QueryContext(ctx, q, args...)
@@ -199,7 +603,10 @@ func (cm CommentModel) GetAllWithUser(discussionId int, page int) (Comments, int
 	}()
 	var comments Comments
 	for rows.Next() {
-		var c Comment
+		var (
+			c        Comment
+			editedAt sql.NullTime
+		)
 		if err := rows.Scan(
 			&c.ID,
 			&c.CreatedAt,
@@ -210,12 +617,17 @@ func (cm CommentModel) GetAllWithUser(discussionId int, page int) (Comments, int
 			&c.U.Name,
 			&c.U.AvatarSrc,
 			&c.NumUpvotes,
+			&c.NumDownvotes,
+			&c.Score,
+			&editedAt,
+			&c.Deleted,
 		); err != nil {
 			return comments, 0, fmt.Errorf(
 				"in CommentModel#Get while mapping fields: %w",
 				err,
 			)
 		}
+		c.EditedAt = editedAt.Time
 		comments = append(comments, c)
 	}
 
@@ -226,6 +638,199 @@ func (cm CommentModel) GetAllWithUser(discussionId int, page int) (Comments, int
 	).Scan(&commsCount); err != nil {
 		return nil, 0, err
 	}
-	currCommCount := commsCount - ((page-1)*10 + len(comments))
+	currCommCount := commsCount - ((page-1)*CommentsPerPage + len(comments))
 	return comments, currCommCount, nil
 }
+
+// GetThread returns a page of comments of the discussion together with
+// their replies up to MaxThreadDepth levels deep, loaded by a single
+// recursive query. Top level comments of the thread are replies to the
+// parent, or comments of the discussion itself when parentId is 0.
+// Only the first RepliesPerComment replies of each comment are loaded,
+// NumReplies tells how many there are. Votes of the viewer are loaded
+// with the comments.
+//
+// Until of the first page should be passed to the following ones,
+// 0 starts a new listing.
+func (cm CommentModel) GetThread(
+	discussionId, parentId, viewerId int,
+	sort CommentSort,
+	page, until int,
+) (*CommentThread, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if until <= 0 {
+		if err := cm.DB.QueryRowContext(
+			ctx,
+			"SELECT COALESCE(MAX(id), 0) FROM comments WHERE discussion_id=$1",
+			&discussionId,
+		).Scan(&until); err != nil {
+			return nil, fmt.Errorf("in CommentModel#GetThread: %w", err)
+		}
+	}
+
+	q := fmt.Sprintf(`
+		WITH RECURSIVE roots AS (
+			SELECT c.id
+			FROM (
+				SELECT %[2]s
+				FROM comments c
+				WHERE c.discussion_id=$1
+					AND COALESCE(c.parent_id, 0)=$2
+					AND c.id<=$3
+			) c
+			ORDER BY %[1]s
+			LIMIT $4
+			OFFSET $5
+		), thread (id, depth) AS (
+			SELECT id, 0 FROM roots
+			UNION ALL
+			SELECT r.id, t.depth + 1
+			FROM thread t
+				CROSS JOIN LATERAL (
+					SELECT c.id
+					FROM (
+						SELECT %[2]s
+						FROM comments c
+						WHERE c.parent_id=t.id
+					) c
+					ORDER BY %[1]s
+					LIMIT $8
+				) r
+			WHERE t.depth + 1 < $6
+		)
+		SELECT
+			c.id,
+			c.created_at,
+			c.updated_at,
+			c.user_id,
+			c.discussion_id,
+			c.content,
+			c.parent_id,
+			c.name,
+			c.avatar_src,
+			c.num_upvotes,
+			c.num_downvotes,
+			c.score,
+			c.num_replies,
+			c.viewer_vote,
+			c.edited_at,
+			c.deleted,
+			c.depth
+		FROM (
+			SELECT
+				c.id,
+				c.created_at,
+				c.updated_at,
+				COALESCE(c.user_id, 0) AS user_id,
+				c.discussion_id,
+				c.content,
+				COALESCE(c.parent_id, 0) AS parent_id,
+				COALESCE(u.name, '') AS name,
+				COALESCE(u.avatar_src, '') AS avatar_src,
+				c.score,
+				(SELECT COUNT(*) FROM upvotes up WHERE up.comment_id=c.id AND up.value > 0) AS num_upvotes,
+				(SELECT COUNT(*) FROM upvotes up WHERE up.comment_id=c.id AND up.value < 0) AS num_downvotes,
+				(SELECT COUNT(*) FROM comments r WHERE r.parent_id=c.id) AS num_replies,
+				COALESCE(
+					(SELECT up.value FROM upvotes up WHERE up.comment_id=c.id AND up.user_id=$7),
+					0
+				) AS viewer_vote,
+				c.edited_at,
+				c.deleted_at IS NOT NULL AS deleted,
+				t.depth
+			FROM thread t
+				JOIN comments c ON c.id=t.id
+				LEFT JOIN users u ON u.id=c.user_id
+		) c
+		ORDER BY c.depth, %[1]s
+	`, sort.orderBy(), commentSortColumns)
+	offset := (page - 1) * CommentsPerPage
+	limit := CommentsPerPage
+	depth := MaxThreadDepth
+	perComment := RepliesPerComment
+	args := []any{
+		&discussionId,
+		&parentId,
+		&until,
+		&limit,
+		&offset,
+		&depth,
+		&viewerId,
+		&perComment,
+	}
+	rows, err := cm.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("in CommentModel#GetThread while querying: %w", err)
+	}
+	defer rows.Close()
+
+	// Rows come level by level in the order of the sort,
+	// so replies are appended to their parents in order.
+	var roots Comments
+	replies := make(map[int]Comments)
+	for rows.Next() {
+		var (
+			c        Comment
+			editedAt sql.NullTime
+		)
+		if err := rows.Scan(
+			&c.ID,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&c.UserId,
+			&c.DiscussionId,
+			&c.Content,
+			&c.ParentId,
+			&c.U.Name,
+			&c.U.AvatarSrc,
+			&c.NumUpvotes,
+			&c.NumDownvotes,
+			&c.Score,
+			&c.NumReplies,
+			&c.ViewerVote,
+			&editedAt,
+			&c.Deleted,
+			&c.Depth,
+		); err != nil {
+			return nil, fmt.Errorf("in CommentModel#GetThread while mapping fields: %w", err)
+		}
+		c.EditedAt = editedAt.Time
+		if c.Depth == 0 {
+			roots = append(roots, c)
+		} else {
+			replies[c.ParentId] = append(replies[c.ParentId], c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("in CommentModel#GetThread: %w", err)
+	}
+
+	var count int
+	if err := cm.DB.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM comments
+		WHERE discussion_id=$1 AND COALESCE(parent_id, 0)=$2 AND id<=$3`,
+		&discussionId,
+		&parentId,
+		&until,
+	).Scan(&count); err != nil {
+		return nil, fmt.Errorf("in CommentModel#GetThread while counting: %w", err)
+	}
+
+	return &CommentThread{
+		Comments: nestReplies(roots, replies),
+		Left:     count - (offset + len(roots)),
+		Until:    until,
+	}, nil
+}
+
+// nestReplies sets replies of the comments from the map
+// of replies keyed by the parent id.
+func nestReplies(comments Comments, replies map[int]Comments) Comments {
+	for i := range comments {
+		comments[i].Replies = nestReplies(replies[comments[i].ID], replies)
+	}
+	return comments
+}
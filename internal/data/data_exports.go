@@ -0,0 +1,171 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DataExportStatus tells whether archive of the export can be downloaded.
+type DataExportStatus string
+
+const (
+	DataExportPending DataExportStatus = "pending"
+	DataExportReady   DataExportStatus = "ready"
+	DataExportFailed  DataExportStatus = "failed"
+)
+
+// DataExport is archive with personal data requested by the user,
+// the archive itself is loaded only when it is downloaded.
+type DataExport struct {
+	ID        int
+	CreatedAt time.Time
+	UserID    int
+	Status    DataExportStatus
+	Size      int
+	ExpiresAt time.Time
+}
+
+type DataExportModel struct {
+	DB *sql.DB
+}
+
+func (dem DataExportModel) Insert(e *DataExport) error {
+	q := `
+		INSERT INTO data_exports (user_id, expires_at)
+		VALUES ($1, $2)
+		RETURNING id, created_at, status
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := dem.DB.QueryRowContext(ctx, q, &e.UserID, &e.ExpiresAt).Scan(
+		&e.ID,
+		&e.CreatedAt,
+		&e.Status,
+	); err != nil {
+		return fmt.Errorf("in DataExportModel#Insert: %w", err)
+	}
+	return nil
+}
+
+func (dem DataExportModel) Complete(id int, archive []byte) error {
+	q := `
+		UPDATE data_exports
+		SET status = 'ready', archive = $1
+		WHERE id = $2 AND status = 'pending'
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := dem.DB.ExecContext(ctx, q, archive, &id)
+	if err != nil {
+		return fmt.Errorf("in DataExportModel#Complete: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in DataExportModel#Complete: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dem DataExportModel) Fail(id int) error {
+	q := "UPDATE data_exports SET status = 'failed' WHERE id = $1 AND status = 'pending'"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := dem.DB.ExecContext(ctx, q, &id); err != nil {
+		return fmt.Errorf("in DataExportModel#Fail: %w", err)
+	}
+	return nil
+}
+
+// FailStale marks exports pending for longer than the timeout as
+// failed, their generation was lost, e.g. when the server restarted.
+func (dem DataExportModel) FailStale(timeout time.Duration) (int64, error) {
+	q := `
+		UPDATE data_exports SET status = 'failed'
+		WHERE status = 'pending' AND created_at <= now() - make_interval(secs => $1)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := dem.DB.ExecContext(ctx, q, timeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("in DataExportModel#FailStale: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("in DataExportModel#FailStale: %w", err)
+	}
+	return n, nil
+}
+
+// Latest returns the most recent export of the user which has not
+// expired yet, ErrRecordNotFound is returned when there is none.
+func (dem DataExportModel) Latest(userID int) (*DataExport, error) {
+	q := `
+		SELECT id, created_at, user_id, status, COALESCE(octet_length(archive), 0), expires_at
+		FROM data_exports
+		WHERE user_id = $1 AND expires_at > now()
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var e DataExport
+	if err := dem.DB.QueryRowContext(ctx, q, &userID).Scan(
+		&e.ID,
+		&e.CreatedAt,
+		&e.UserID,
+		&e.Status,
+		&e.Size,
+		&e.ExpiresAt,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("in DataExportModel#Latest: %w", err)
+		}
+	}
+	return &e, nil
+}
+
+// Archive returns ready archive of the export owned by the user.
+func (dem DataExportModel) Archive(userID, id int) ([]byte, error) {
+	q := `
+		SELECT archive
+		FROM data_exports
+		WHERE id = $1 AND user_id = $2 AND status = 'ready' AND expires_at > now()
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var archive []byte
+	if err := dem.DB.QueryRowContext(ctx, q, &id, &userID).Scan(&archive); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("in DataExportModel#Archive: %w", err)
+		}
+	}
+	return archive, nil
+}
+
+// DeleteExpired removes exports which can not be downloaded anymore.
+func (dem DataExportModel) DeleteExpired() (int64, error) {
+	q := "DELETE FROM data_exports WHERE expires_at <= now()"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := dem.DB.ExecContext(ctx, q)
+	if err != nil {
+		return 0, fmt.Errorf("in DataExportModel#DeleteExpired: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("in DataExportModel#DeleteExpired: %w", err)
+	}
+	return n, nil
+}
@@ -6,29 +6,127 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrDuplicatedUrl = errors.New("duplicated url")
+)
+
+// DiscussionsPerPage is the number of discussions returned by GetAll.
+const DiscussionsPerPage = 9
+
+// DiscussionSort determines order in which discussions are listed.
+type DiscussionSort string
+
+const (
+	// SortHot orders discussions by upvotes decayed with the age of
+	// the discussion, similar to the Hacker News front page. Scores
+	// are stored and refreshed periodically, see RefreshHotScores.
+	SortHot DiscussionSort = "hot"
+	// SortNew orders discussions from the newest.
+	SortNew DiscussionSort = "new"
+	// SortTopDay orders discussions from the last day by upvotes.
+	SortTopDay DiscussionSort = "top-day"
+	// SortTopWeek orders discussions from the last week by upvotes.
+	SortTopWeek DiscussionSort = "top-week"
+	// SortTopAll orders all discussions by upvotes.
+	SortTopAll DiscussionSort = "top-all"
 )
 
+// ParseDiscussionSort returns sort matching the given value.
+// Unknown values fall back to SortHot.
+func ParseDiscussionSort(value string) DiscussionSort {
+	switch ds := DiscussionSort(value); ds {
+	case SortHot, SortNew, SortTopDay, SortTopWeek, SortTopAll:
+		return ds
+	default:
+		return SortHot
+	}
+}
+
+// orderBy returns ORDER BY clause together with condition limiting
+// listed discussions to the time window of the sort.
+func (ds DiscussionSort) orderBy() (clause string, condition string) {
+	switch ds {
+	case SortNew:
+		return "d.created_at DESC", "TRUE"
+	case SortTopDay:
+		return "d.num_upvotes DESC, d.created_at DESC",
+			"d.created_at > now() - INTERVAL '1 day'"
+	case SortTopWeek:
+		return "d.num_upvotes DESC, d.created_at DESC",
+			"d.created_at > now() - INTERVAL '1 week'"
+	case SortTopAll:
+		return "d.num_upvotes DESC, d.created_at DESC", "TRUE"
+	default:
+		// Score is refreshed by RefreshHotScores, id tells
+		// apart discussions of the same score.
+		return "d.hot_score DESC, d.id DESC", "TRUE"
+	}
+}
+
 type Discussion struct {
-	ID          int
-	CreatedAt   time.Time
-	CategoryID  int
-	UpdatedAt   time.Time
-	Url         string
-	Title       string
-	Description string
-	PreviewSrc  string
-	UserId      int
+	ID            int
+	CreatedAt     time.Time
+	CategoryID    int
+	UpdatedAt     time.Time
+	Url           string
+	Title         string
+	Description   string
+	PreviewSrc    string
+	UserId        int
+	Version       int
+	NumUpvotes    int
+	CanonicalUrl  string
+	PreviewStatus PreviewStatus
+	Metadata      DiscussionMetadata
+}
+
+// DiscussionMetadata is extracted from the shared page
+// to present it the way its authors intended.
+type DiscussionMetadata struct {
+	Title        string
+	Description  string
+	ImageUrl     string
+	SiteName     string
+	FaviconUrl   string
+	CanonicalUrl string
 }
 
 type DiscussionModel struct {
 	DB *sql.DB
 }
 
+// Insert creates the discussion. Discussions without preview are marked
+// as pending and job generating their preview is queued along with them.
 func (dm DiscussionModel) Insert(discussion *Discussion) error {
 	query := `
-		INSERT INTO discussions (url, title, description, preview_src, category_id, user_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at, category_id, user_id
+		WITH
+			d AS (
+				INSERT INTO discussions (
+					url,
+					title,
+					description,
+					preview_src,
+					category_id,
+					user_id,
+					canonical_url,
+					preview_status
+				)
+				VALUES (
+					$1, $2, $3, $4, $5, $6, NULLIF($7, ''),
+					CASE WHEN $4 = '' THEN 'pending' ELSE 'ready' END::PREVIEW_STATUS
+				)
+				RETURNING id, created_at, updated_at, category_id, user_id, version, url, preview_status
+			),
+			j AS (
+				INSERT INTO preview_jobs (discussion_id, url)
+				SELECT id, url FROM d WHERE preview_status = 'pending'
+			)
+		SELECT id, created_at, updated_at, category_id, user_id, version, preview_status
+		FROM d
 	`
 	var userID sql.NullInt64
 	if discussion.UserId != 0 {
@@ -43,6 +141,7 @@ func (dm DiscussionModel) Insert(discussion *Discussion) error {
 		discussion.PreviewSrc,
 		discussion.CategoryID,
 		userID,
+		discussion.CanonicalUrl,
 	}
 	if err := dm.DB.QueryRow(query, queryArgs...).Scan(
 		&discussion.ID,
@@ -50,7 +149,13 @@ func (dm DiscussionModel) Insert(discussion *Discussion) error {
 		&discussion.UpdatedAt,
 		&discussion.CategoryID,
 		&userID,
+		&discussion.Version,
+		&discussion.PreviewStatus,
 	); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Message == `duplicate key value violates unique constraint "discussions_canonical_url_key"` {
+			return fmt.Errorf("in DiscussionModel#Insert: %w", ErrDuplicatedUrl)
+		}
 		return fmt.Errorf("in DiscussionModel#Insert: %w", err)
 	}
 
@@ -76,7 +181,16 @@ func (dm DiscussionModel) Get(id int64) (*Discussion, error) {
 			description,
 			preview_src,
 			category_id,
-			COALESCE(user_id, 0)
+			COALESCE(user_id, 0),
+			version,
+			num_upvotes,
+			preview_status,
+			meta_title,
+			meta_description,
+			meta_image_url,
+			meta_site_name,
+			meta_favicon_url,
+			meta_canonical_url
 		FROM
 			discussions
 		WHERE id=$1
@@ -91,6 +205,15 @@ func (dm DiscussionModel) Get(id int64) (*Discussion, error) {
 		&d.PreviewSrc,
 		&d.CategoryID,
 		&d.UserId,
+		&d.Version,
+		&d.NumUpvotes,
+		&d.PreviewStatus,
+		&d.Metadata.Title,
+		&d.Metadata.Description,
+		&d.Metadata.ImageUrl,
+		&d.Metadata.SiteName,
+		&d.Metadata.FaviconUrl,
+		&d.Metadata.CanonicalUrl,
 	); err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -102,8 +225,192 @@ func (dm DiscussionModel) Get(id int64) (*Discussion, error) {
 	return &d, nil
 }
 
-func (dm DiscussionModel) GetAll(category string, page int) ([]Discussion, error) {
+// GetByCanonicalUrl returns discussion sharing the resource
+// with the given canonical url.
+func (dm DiscussionModel) GetByCanonicalUrl(canonicalUrl string) (*Discussion, error) {
+	var d Discussion
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	query := `
+		SELECT
+			id,
+			created_at,
+			updated_at,
+			url,
+			title,
+			COALESCE(user_id, 0),
+			canonical_url
+		FROM
+			discussions
+		WHERE canonical_url=$1
+	`
+	if err := dm.DB.QueryRowContext(ctx, query, &canonicalUrl).Scan(
+		&d.ID,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.Url,
+		&d.Title,
+		&d.UserId,
+		&d.CanonicalUrl,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("in DiscussionModel#GetByCanonicalUrl: %w", err)
+		}
+	}
+	return &d, nil
+}
+
+// DiscussionUrl is url shared by the discussion.
+type DiscussionUrl struct {
+	ID  int
+	Url string
+}
+
+// WithoutCanonicalUrl returns up to limit discussions with id greater
+// than afterId whose canonical url is not set, ordered by id.
+func (dm DiscussionModel) WithoutCanonicalUrl(afterId, limit int) ([]DiscussionUrl, error) {
 	query := `
+		SELECT id, url
+		FROM discussions
+		WHERE id > $1 AND canonical_url IS NULL
+		ORDER BY id
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := dm.DB.QueryContext(ctx, query, &afterId, &limit)
+	if err != nil {
+		return nil, fmt.Errorf("in DiscussionModel#WithoutCanonicalUrl: %w", err)
+	}
+	defer rows.Close()
+	var urls []DiscussionUrl
+	for rows.Next() {
+		var du DiscussionUrl
+		if err := rows.Scan(&du.ID, &du.Url); err != nil {
+			return nil, fmt.Errorf("in DiscussionModel#WithoutCanonicalUrl: %w", err)
+		}
+		urls = append(urls, du)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("in DiscussionModel#WithoutCanonicalUrl: %w", err)
+	}
+	return urls, nil
+}
+
+// SetCanonicalUrl sets canonical url of the discussion which has none
+// yet. ErrDuplicatedUrl is returned when other discussion has it.
+func (dm DiscussionModel) SetCanonicalUrl(id int, canonicalUrl string) error {
+	query := `
+		UPDATE discussions
+		SET canonical_url = $1
+		WHERE id = $2 AND canonical_url IS NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := dm.DB.ExecContext(ctx, query, &canonicalUrl, &id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Message == `duplicate key value violates unique constraint "discussions_canonical_url_key"` {
+			return fmt.Errorf("in DiscussionModel#SetCanonicalUrl: %w", ErrDuplicatedUrl)
+		}
+		return fmt.Errorf("in DiscussionModel#SetCanonicalUrl: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in DiscussionModel#SetCanonicalUrl: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DiscussionImages are image and favicon of the shared page.
+type DiscussionImages struct {
+	ID         int
+	ImageUrl   string
+	FaviconUrl string
+}
+
+// WithRemoteImages returns up to limit discussions with id greater
+// than afterId whose image or favicon is not stored under storedPrefix,
+// ordered by id.
+func (dm DiscussionModel) WithRemoteImages(
+	storedPrefix string,
+	afterId, limit int,
+) ([]DiscussionImages, error) {
+	query := `
+		SELECT id, meta_image_url, meta_favicon_url
+		FROM discussions
+		WHERE id > $1 AND (
+			(meta_image_url <> '' AND NOT starts_with(meta_image_url, $2)) OR
+			(meta_favicon_url <> '' AND NOT starts_with(meta_favicon_url, $2))
+		)
+		ORDER BY id
+		LIMIT $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := dm.DB.QueryContext(ctx, query, &afterId, &storedPrefix, &limit)
+	if err != nil {
+		return nil, fmt.Errorf("in DiscussionModel#WithRemoteImages: %w", err)
+	}
+	defer rows.Close()
+	var images []DiscussionImages
+	for rows.Next() {
+		var di DiscussionImages
+		if err := rows.Scan(&di.ID, &di.ImageUrl, &di.FaviconUrl); err != nil {
+			return nil, fmt.Errorf("in DiscussionModel#WithRemoteImages: %w", err)
+		}
+		images = append(images, di)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("in DiscussionModel#WithRemoteImages: %w", err)
+	}
+	return images, nil
+}
+
+// ReplaceImages sets images of the discussion unless they changed
+// since old was read, ErrRecordNotFound is returned then.
+func (dm DiscussionModel) ReplaceImages(old, new DiscussionImages) error {
+	query := `
+		UPDATE discussions
+		SET meta_image_url = $1, meta_favicon_url = $2
+		WHERE id = $3 AND meta_image_url = $4 AND meta_favicon_url = $5
+	`
+	args := []any{
+		&new.ImageUrl,
+		&new.FaviconUrl,
+		&old.ID,
+		&old.ImageUrl,
+		&old.FaviconUrl,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := dm.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("in DiscussionModel#ReplaceImages: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in DiscussionModel#ReplaceImages: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (dm DiscussionModel) GetAll(
+	category string,
+	sort DiscussionSort,
+	page int,
+) ([]Discussion, error) {
+	orderBy, condition := sort.orderBy()
+	query := fmt.Sprintf(`
 	SELECT
 		d.id,
 		d.created_at,
@@ -112,17 +419,23 @@ func (dm DiscussionModel) GetAll(category string, page int) ([]Discussion, error
 		d.title,
 		d.description,
 		d.preview_src,
-		d.category_id
+		d.category_id,
+		COALESCE(d.user_id, 0),
+		d.num_upvotes,
+		d.preview_status,
+		d.meta_image_url,
+		d.meta_site_name,
+		d.meta_favicon_url
 	FROM
 		discussions d
 		JOIN categories c ON c.id=d.category_id
-	WHERE (LOWER(c.name)=LOWER($1) OR $1='')
+	WHERE (LOWER(c.name)=LOWER($1) OR $1='') AND %s
 	ORDER BY
-		d.created_at DESC
-	LIMIT 9
+		%s
+	LIMIT %d
 	OFFSET $2
-	`
-	offset := (page - 1) * 9
+	`, condition, orderBy, DiscussionsPerPage)
+	offset := (page - 1) * DiscussionsPerPage
 	rows, err := dm.DB.Query(query, &category, &offset)
 	if err != nil {
 		return nil, err
@@ -147,6 +460,12 @@ func (dm DiscussionModel) GetAll(category string, page int) ([]Discussion, error
 			&discussion.Description,
 			&discussion.PreviewSrc,
 			&discussion.CategoryID,
+			&discussion.UserId,
+			&discussion.NumUpvotes,
+			&discussion.PreviewStatus,
+			&discussion.Metadata.ImageUrl,
+			&discussion.Metadata.SiteName,
+			&discussion.Metadata.FaviconUrl,
 		); err != nil {
 			return discussions, err
 		}
@@ -159,10 +478,323 @@ func (dm DiscussionModel) GetAll(category string, page int) ([]Discussion, error
 	return discussions, nil
 }
 
+// Count returns the number of discussions listed by GetAll
+// for the category and sort, across all pages.
+func (dm DiscussionModel) Count(category string, sort DiscussionSort) (int, error) {
+	_, condition := sort.orderBy()
+	query := fmt.Sprintf(`
+		SELECT count(*)
+		FROM
+			discussions d
+			JOIN categories c ON c.id=d.category_id
+		WHERE (LOWER(c.name)=LOWER($1) OR $1='') AND %s
+	`, condition)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var count int
+	if err := dm.DB.QueryRowContext(ctx, query, category).Scan(&count); err != nil {
+		return 0, fmt.Errorf("in DiscussionModel#Count: %w", err)
+	}
+	return count, nil
+}
+
 func (dm DiscussionModel) Update(discussion *Discussion) error {
+	query := `
+		UPDATE
+			discussions
+		SET
+			updated_at = current_timestamp,
+			title = $1,
+			description = $2,
+			category_id = $3,
+			version = version + 1
+		WHERE
+			id = $4 AND version = $5
+		RETURNING
+			updated_at, version
+	`
+	args := []any{
+		&discussion.Title,
+		&discussion.Description,
+		&discussion.CategoryID,
+		&discussion.ID,
+		&discussion.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := dm.DB.QueryRowContext(ctx, query, args...).Scan(
+		&discussion.UpdatedAt,
+		&discussion.Version,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return fmt.Errorf("in DiscussionModel#Update: %w", err)
+		}
+	}
+	return nil
+}
+
+// UpdateMetadata stores metadata extracted from the shared page.
+func (dm DiscussionModel) UpdateMetadata(id int, m DiscussionMetadata) error {
+	query := `
+		UPDATE
+			discussions
+		SET
+			meta_title = $1,
+			meta_description = $2,
+			meta_image_url = $3,
+			meta_site_name = $4,
+			meta_favicon_url = $5,
+			meta_canonical_url = $6
+		WHERE
+			id = $7
+	`
+	args := []any{
+		&m.Title,
+		&m.Description,
+		&m.ImageUrl,
+		&m.SiteName,
+		&m.FaviconUrl,
+		&m.CanonicalUrl,
+		&id,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := dm.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("in DiscussionModel#UpdateMetadata: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in DiscussionModel#UpdateMetadata: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
 	return nil
 }
 
 func (dm DiscussionModel) Delete(id int64) error {
+	query := "DELETE FROM discussions WHERE id=$1"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := dm.DB.ExecContext(ctx, query, &id)
+	if err != nil {
+		return fmt.Errorf("in DiscussionModel#Delete: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in DiscussionModel#Delete: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Upvote registers upvote of the user and bumps upvotes counter
+// of the discussion within a single transaction.
+// hotScoreWindow limits discussions whose hot score is refreshed,
+// the score of older ones is negligible and is kept at 0.
+const hotScoreWindow = "30 days"
+
+// RefreshHotScores recomputes hot scores of recent discussions. Score
+// is the number of upvotes divided by the age of the discussion in
+// hours raised to the gravity of 1.8, so older discussions sink.
+func (dm DiscussionModel) RefreshHotScores() (int64, error) {
+	query := fmt.Sprintf(`
+		UPDATE discussions
+		SET hot_score = CASE
+			WHEN created_at > now() - INTERVAL '%[1]s' THEN num_upvotes / POWER(
+				EXTRACT(EPOCH FROM (now() - created_at)) / 3600 + 2,
+				1.8
+			)
+			ELSE 0
+		END
+		WHERE created_at > now() - INTERVAL '%[1]s' OR hot_score <> 0
+	`, hotScoreWindow)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	res, err := dm.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("in DiscussionModel#RefreshHotScores: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("in DiscussionModel#RefreshHotScores: %w", err)
+	}
+	return n, nil
+}
+
+// Upvote records upvote of the user. ErrRecordNotFound is returned
+// when the discussion does not exist.
+func (dm DiscussionModel) Upvote(userId, discussionId int) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := dm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("in DiscussionModel#Upvote: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q := "INSERT INTO discussion_upvotes (user_id, discussion_id) VALUES ($1, $2)"
+	if _, err = tx.ExecContext(ctx, q, &userId, &discussionId); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Message == `duplicate key value violates unique constraint "discussion_upvotes_user_id_discussion_id_key"` {
+			return fmt.Errorf("user can upvote discussion only once: %w", ErrUniquenessViolation)
+		}
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "discussion_upvotes_discussion_id_fkey" {
+			return ErrRecordNotFound
+		}
+		return fmt.Errorf("in DiscussionModel#Upvote: %w", err)
+	}
+
+	q = "UPDATE discussions SET num_upvotes = num_upvotes + 1 WHERE id=$1"
+	if _, err = tx.ExecContext(ctx, q, &discussionId); err != nil {
+		return fmt.Errorf("in DiscussionModel#Upvote: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("in DiscussionModel#Upvote: %w", err)
+	}
 	return nil
 }
+
+const (
+	// HighlightStart marks beginning of the search term
+	// highlighted within search result headlines.
+	HighlightStart = "[[[mark"
+	// HighlightStop marks end of the search term
+	// highlighted within search result headlines.
+	HighlightStop = "mark]]]"
+)
+
+type DiscussionSearchResult struct {
+	Discussion
+	Rank float64
+	// TitleHeadline and DescriptionHeadline contain fragments of the
+	// discussion with matched terms wrapped in HighlightStart and
+	// HighlightStop markers. Content itself is not escaped.
+	TitleHeadline       string
+	DescriptionHeadline string
+}
+
+// Search performs full text search over discussions and their comments.
+//
+// Discussion matches whenever its title, description or any of its comments
+// match the query. Comment matches weigh half of the discussion ones.
+func (dm DiscussionModel) Search(
+	text string,
+	category string,
+	page int,
+) ([]DiscussionSearchResult, error) {
+	query := fmt.Sprintf(`
+	WITH
+		q AS (
+			SELECT websearch_to_tsquery('english', $1) AS query
+		),
+		matches AS (
+			SELECT d.id, ts_rank(d.search_vector, q.query) AS rank
+			FROM discussions d, q
+			WHERE d.search_vector @@ q.query
+			UNION ALL
+			SELECT c.discussion_id, ts_rank(c.search_vector, q.query) * 0.5
+			FROM comments c, q
+			WHERE c.search_vector @@ q.query
+		),
+		ranked AS (
+			SELECT id, MAX(rank) AS rank
+			FROM matches
+			GROUP BY id
+		)
+	SELECT
+		d.id,
+		d.created_at,
+		d.updated_at,
+		d.url,
+		d.title,
+		d.description,
+		d.preview_src,
+		d.category_id,
+		COALESCE(d.user_id, 0),
+		d.num_upvotes,
+		d.preview_status,
+		d.meta_image_url,
+		d.meta_site_name,
+		d.meta_favicon_url,
+		r.rank,
+		ts_headline(
+			'english',
+			d.title,
+			q.query,
+			'StartSel=%[1]s, StopSel=%[2]s, HighlightAll=TRUE'
+		),
+		ts_headline(
+			'english',
+			d.description,
+			q.query,
+			'StartSel=%[1]s, StopSel=%[2]s, MaxFragments=2, MaxWords=30, MinWords=10'
+		)
+	FROM
+		ranked r
+		JOIN discussions d ON d.id=r.id
+		JOIN categories c ON c.id=d.category_id
+		CROSS JOIN q
+	WHERE (LOWER(c.name)=LOWER($2) OR $2='')
+	ORDER BY
+		r.rank DESC,
+		d.id DESC
+	LIMIT 9
+	OFFSET $3
+	`, HighlightStart, HighlightStop)
+	offset := (page - 1) * 9
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := dm.DB.QueryContext(ctx, query, &text, &category, &offset)
+	if err != nil {
+		return nil, fmt.Errorf("in DiscussionModel#Search: %w", err)
+	}
+	defer func() {
+		rcErr := rows.Close()
+		if rcErr != nil && err == nil {
+			err = rcErr
+		}
+	}()
+
+	var results []DiscussionSearchResult
+	for rows.Next() {
+		var r DiscussionSearchResult
+		if err := rows.Scan(
+			&r.ID,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+			&r.Url,
+			&r.Title,
+			&r.Description,
+			&r.PreviewSrc,
+			&r.CategoryID,
+			&r.UserId,
+			&r.NumUpvotes,
+			&r.PreviewStatus,
+			&r.Metadata.ImageUrl,
+			&r.Metadata.SiteName,
+			&r.Metadata.FaviconUrl,
+			&r.Rank,
+			&r.TitleHeadline,
+			&r.DescriptionHeadline,
+		); err != nil {
+			return results, fmt.Errorf("in DiscussionModel#Search: %w", err)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return results, fmt.Errorf("in DiscussionModel#Search: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// testDB connects to the migrated database given by SAD_TEST_DSN,
+// tests running queries against real rows are skipped without it.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("SAD_TEST_DSN")
+	if dsn == "" {
+		t.Skip("SAD_TEST_DSN is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestDiscussionSearch(t *testing.T) {
+	db := testDB(t)
+	models := NewModels(db, nil)
+
+	suffix := time.Now().UnixNano() % 1e9
+	u := &User{
+		Name:      fmt.Sprintf("search%d", suffix),
+		Email:     fmt.Sprintf("search%d@example.com", suffix),
+		Activated: true,
+	}
+	if err := u.Password.Set("Passw0rd!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Users.Insert(u); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec("DELETE FROM users WHERE id = $1", u.ID)
+	})
+
+	var categoryID int
+	if err := db.QueryRow("SELECT id FROM categories LIMIT 1").Scan(&categoryID); err != nil {
+		t.Fatal(err)
+	}
+	word := fmt.Sprintf("quokka%d", suffix)
+	d := &Discussion{
+		Url:         fmt.Sprintf("https://example.com/%s", word),
+		Title:       "Search " + word,
+		Description: "Discussion found by the search test",
+		PreviewSrc:  "/public/placeholder.webp",
+		CategoryID:  categoryID,
+		UserId:      u.ID,
+	}
+	if err := models.Discussions.Insert(d); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec("DELETE FROM discussions WHERE id = $1", d.ID)
+	})
+
+	results, err := models.Discussions.Search(word, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	r := results[0]
+	if r.ID != d.ID || r.UserId != u.ID || r.CategoryID != categoryID {
+		t.Errorf(
+			"got discussion %d of user %d in category %d, want %d of %d in %d",
+			r.ID, r.UserId, r.CategoryID, d.ID, u.ID, categoryID,
+		)
+	}
+	if r.TitleHeadline == "" {
+		t.Error("title headline is empty")
+	}
+}
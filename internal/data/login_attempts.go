@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Reasons of failed login attempts.
+const (
+	LoginUnknownEmail  = "unknown_email"
+	LoginWrongPassword = "wrong_password"
+	LoginWrongCode     = "wrong_code" // of the second factor
+	LoginThrottled     = "throttled"
+	LoginLocked        = "locked"
+)
+
+type LoginAttempt struct {
+	ID        int
+	CreatedAt time.Time
+	Email     string
+	// UserID is 0 when there is no account with the email.
+	UserID  int
+	IP      string
+	Success bool
+	Reason  string
+}
+
+// LoginFailures summarizes failed attempts counted against the
+// account or address, attempts rejected without checking the
+// password or the second factor are not counted.
+type LoginFailures struct {
+	Count int
+	Last  time.Time
+}
+
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+func (lam LoginAttemptModel) Insert(a *LoginAttempt) error {
+	query := `
+		INSERT INTO login_attempts (email, user_id, ip, success, reason)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+		RETURNING id, created_at
+	`
+	args := []any{&a.Email, &a.UserID, &a.IP, &a.Success, &a.Reason}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := lam.DB.QueryRowContext(ctx, query, args...).Scan(
+		&a.ID,
+		&a.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("in LoginAttemptModel#Insert: %w", err)
+	}
+	return nil
+}
+
+// FailuresForEmail counts failures within the window
+// which happened after the last successful login.
+func (lam LoginAttemptModel) FailuresForEmail(email string, window time.Duration) (*LoginFailures, error) {
+	query := `
+		SELECT count(*), COALESCE(max(created_at), 'epoch')
+		FROM login_attempts
+		WHERE
+			email = $1
+			AND NOT success
+			AND reason IN ($2, $3, $4)
+			AND created_at > now() - make_interval(secs => $5)
+			AND created_at > COALESCE(
+				(SELECT max(created_at) FROM login_attempts WHERE email = $1 AND success),
+				'epoch'
+			)
+	`
+	return lam.failures(query, "FailuresForEmail", email, window)
+}
+
+// FailuresForIP counts failures within the window regardless
+// of the account, it catches guessing spread over many accounts.
+func (lam LoginAttemptModel) FailuresForIP(ip string, window time.Duration) (*LoginFailures, error) {
+	query := `
+		SELECT count(*), COALESCE(max(created_at), 'epoch')
+		FROM login_attempts
+		WHERE
+			ip = $1
+			AND NOT success
+			AND reason IN ($2, $3, $4)
+			AND created_at > now() - make_interval(secs => $5)
+	`
+	return lam.failures(query, "FailuresForIP", ip, window)
+}
+
+func (lam LoginAttemptModel) failures(
+	query, method, key string,
+	window time.Duration,
+) (*LoginFailures, error) {
+	args := []any{
+		key,
+		LoginUnknownEmail,
+		LoginWrongPassword,
+		LoginWrongCode,
+		window.Seconds(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var f LoginFailures
+	if err := lam.DB.QueryRowContext(ctx, query, args...).Scan(&f.Count, &f.Last); err != nil {
+		return nil, fmt.Errorf("in LoginAttemptModel#%s: %w", method, err)
+	}
+	return &f, nil
+}
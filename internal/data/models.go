@@ -18,9 +18,19 @@ type Models struct {
 	Discussions interface {
 		Insert(discussion *Discussion) error
 		Get(id int64) (*Discussion, error)
-		GetAll(category string, page int) ([]Discussion, error)
+		GetByCanonicalUrl(canonicalUrl string) (*Discussion, error)
+		WithoutCanonicalUrl(afterId, limit int) ([]DiscussionUrl, error)
+		SetCanonicalUrl(id int, canonicalUrl string) error
+		WithRemoteImages(storedPrefix string, afterId, limit int) ([]DiscussionImages, error)
+		ReplaceImages(old, new DiscussionImages) error
+		GetAll(category string, sort DiscussionSort, page int) ([]Discussion, error)
+		Count(category string, sort DiscussionSort) (int, error)
 		Update(discussion *Discussion) error
+		UpdateMetadata(id int, m DiscussionMetadata) error
 		Delete(id int64) error
+		Upvote(userId, discussionId int) error
+		RefreshHotScores() (int64, error)
+		Search(text string, category string, page int) ([]DiscussionSearchResult, error)
 	}
 	Users interface {
 		Insert(user *User) error
@@ -30,17 +40,30 @@ type Models struct {
 		GetForToken(scope string, plainTextToken string) (*User, error)
 		Exists(id int) (bool, error)
 		AvatarSrcByID(id int) (string, error)
+		UpdateAvatar(id int, src string) (oldSrc string, err error)
+		SetPendingEmail(id int, email string) error
+		ConfirmEmail(id int) (oldEmail, newEmail string, err error)
 		Authorized(userID int, permission string) (bool, error)
 		GetEmail(id int) (email string, err error)
 		GetDescription(id int) (string, error)
 		HasRole(userId int, rolename string) (bool, error)
+		Reputation(userId int) (int, error)
 		Ban(userId int) error
 		Banned(userId int) (bool, error)
+		Activated(userId int) (bool, error)
+		LockedUntil(id int) (time.Time, error)
+		Lock(id int, until time.Time) (bool, error)
+		Unlock(id int) error
 	}
 	Tokens interface {
 		New(userID int, lifeTime time.Duration, tokenType TokenType) (*Token, error)
 		Insert(t *Token) error
 		DeleteAllForUser(scope string, userID int) error
+		LastCreatedAt(scope string, userID int) (time.Time, error)
+		NewPersonal(userID int, name string, scopes TokenScopes, lifeTime time.Duration) (*Token, error)
+		GetAllPersonal(userID int) ([]PersonalToken, error)
+		DeletePersonal(userID int, id int64) error
+		UsePersonal(plainText string) (TokenScopes, error)
 	}
 	Categories interface {
 		GetAll() ([]Category, error)
@@ -59,23 +82,81 @@ type Models struct {
 		Insert(comment *Comment) error
 		GetAllWithUser(discussionId int, page int) (Comments, int, error)
 		GetAllChildren(parentId, page int) (comms Comments, numCurrComms int, err error)
-		Upvote(userId, commentId int) error
+		GetThread(
+			discussionId, parentId, viewerId int,
+			sort CommentSort,
+			page, until int,
+		) (*CommentThread, error)
+		GetDiscussionID(id int) (int, error)
+		Vote(userId, commentId, value int) (score, vote int, err error)
+		ViewerVote(userId, commentId int) (int, error)
+		Get(id int) (*Comment, error)
+		Update(comment *Comment) error
+		Delete(id int) error
+		Revisions(id int) ([]CommentRevision, error)
+	}
+	PreviewJobs interface {
+		Claim() (*PreviewJob, error)
+		Complete(job *PreviewJob, previewSrc string) error
+		Fail(job *PreviewJob, reason string) error
+	}
+	TwoFactor interface {
+		Get(userID int) (*TwoFactor, error)
+		Required(userID int) (bool, error)
+		SetPendingSecret(userID int, secret string) error
+		Enable(userID int, step int64, recoveryCodes []string) error
+		Disable(userID int) error
+		UseStep(userID int, step int64) (bool, error)
+		UseRecoveryCode(userID int, code string) (bool, error)
+		RecoveryCodesLeft(userID int) (int, error)
+	}
+	LoginAttempts interface {
+		Insert(a *LoginAttempt) error
+		FailuresForEmail(email string, window time.Duration) (*LoginFailures, error)
+		FailuresForIP(ip string, window time.Duration) (*LoginFailures, error)
 	}
 	Reports interface {
 		Insert(r *Report) error
 		GetAll(cursor, limit int) ([]Report, error)
 		AnyAfter(lastSeenId int) (bool, error)
 	}
+	Accounts interface {
+		PersonalData(userID int) (*PersonalData, error)
+		ScheduleDeletion(userID int, at time.Time) error
+		CancelDeletion(userID int) error
+		DeletionScheduledAt(userID int) (time.Time, error)
+		DueForDeletion() ([]int, error)
+		Delete(userID int) (avatarSrc string, err error)
+	}
+	DataExports interface {
+		Insert(e *DataExport) error
+		Complete(id int, archive []byte) error
+		Fail(id int) error
+		FailStale(timeout time.Duration) (int64, error)
+		Latest(userID int) (*DataExport, error)
+		Archive(userID, id int) ([]byte, error)
+		DeleteExpired() (int64, error)
+	}
+	Sessions interface {
+		Commit(token string, b []byte, expiry time.Time, userID int) error
+		UserTokens(userID int) ([]string, error)
+	}
 }
 
 func NewModels(db *sql.DB, logger *slog.Logger) Models {
 	return Models{
-		Discussions: DiscussionModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Categories:  CategoryModel{DB: db},
-		Roles:       RoleModel{DB: db},
-		Comments:    CommentModel{DB: db},
-		Reports:     ReportModel{DB: db, logger: logger},
+		Discussions:   DiscussionModel{DB: db},
+		Users:         UserModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Categories:    CategoryModel{DB: db},
+		Roles:         RoleModel{DB: db},
+		Comments:      CommentModel{DB: db},
+		PreviewJobs:   PreviewJobModel{DB: db},
+		TwoFactor:     TwoFactorModel{DB: db},
+		LoginAttempts: LoginAttemptModel{DB: db},
+		Reports:       ReportModel{DB: db, logger: logger},
+		Accounts:      AccountModel{DB: db},
+		DataExports:   DataExportModel{DB: db},
+		Sessions:      SessionModel{DB: db},
 	}
 }
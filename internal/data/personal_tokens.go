@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Scopes of personal access tokens. Read scope allows safe
+// requests only, write scope allows requests changing data.
+// Role of the user limits both of them as well.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// MaxPersonalTokens is the number of active tokens a user can have.
+const MaxPersonalTokens = 20
+
+var ErrTooManyTokens = errors.New("too many tokens")
+
+type TokenScopes []string
+
+func (ts TokenScopes) Value() (driver.Value, error) {
+	if ts == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(ts)
+}
+
+func (ts *TokenScopes) Scan(value any) error {
+	switch value.(type) {
+	case []byte:
+		return json.Unmarshal(value.([]byte), &ts)
+	default:
+		return errors.New("type assertion to []byte failed")
+	}
+}
+
+func (ts TokenScopes) Has(scope string) bool {
+	return slices.Contains(ts, scope)
+}
+
+// PersonalToken describes personal access token without its
+// secret, which is shown to the user only once on creation.
+type PersonalToken struct {
+	ID         int64
+	CreatedAt  time.Time
+	ExpiredAt  time.Time
+	LastUsedAt *time.Time
+	Name       string
+	Scopes     TokenScopes
+}
+
+// NewPersonal issues personal access token for the user.
+// ErrTooManyTokens is returned when the user reached MaxPersonalTokens.
+func (tm TokenModel) NewPersonal(
+	userID int,
+	name string,
+	scopes TokenScopes,
+	lifeTime time.Duration,
+) (*Token, error) {
+	query := `
+		SELECT count(*)
+		FROM tokens
+		WHERE user_id = $1 AND token_type = $2 AND expired_at > now()
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var count int
+	if err := tm.DB.QueryRowContext(
+		ctx,
+		query,
+		userID,
+		TokenTypeAuthentication,
+	).Scan(&count); err != nil {
+		return nil, fmt.Errorf("in TokenModel#NewPersonal: %w", err)
+	}
+	if count >= MaxPersonalTokens {
+		return nil, ErrTooManyTokens
+	}
+
+	t, err := genToken(userID, lifeTime, TokenTypeAuthentication)
+	if err != nil {
+		return nil, fmt.Errorf("in TokenModel#NewPersonal: %w", err)
+	}
+	t.Name = name
+	t.Scopes = scopes
+	if err := tm.Insert(t); err != nil {
+		return nil, fmt.Errorf("in TokenModel#NewPersonal: %w", err)
+	}
+	return t, nil
+}
+
+// GetAllPersonal lists active personal access tokens of the user.
+func (tm TokenModel) GetAllPersonal(userID int) ([]PersonalToken, error) {
+	query := `
+		SELECT id, created_at, expired_at, last_used_at, name, scopes
+		FROM tokens
+		WHERE user_id = $1 AND token_type = $2 AND expired_at > now()
+		ORDER BY created_at DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := tm.DB.QueryContext(ctx, query, userID, TokenTypeAuthentication)
+	if err != nil {
+		return nil, fmt.Errorf("in TokenModel#GetAllPersonal: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []PersonalToken
+	for rows.Next() {
+		var (
+			pt         PersonalToken
+			lastUsedAt sql.NullTime
+		)
+		if err := rows.Scan(
+			&pt.ID,
+			&pt.CreatedAt,
+			&pt.ExpiredAt,
+			&lastUsedAt,
+			&pt.Name,
+			&pt.Scopes,
+		); err != nil {
+			return nil, fmt.Errorf("in TokenModel#GetAllPersonal: %w", err)
+		}
+		if lastUsedAt.Valid {
+			pt.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, pt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("in TokenModel#GetAllPersonal: %w", err)
+	}
+	return tokens, nil
+}
+
+// DeletePersonal revokes the token. ErrRecordNotFound is returned
+// when the token does not exist or belongs to another user.
+func (tm TokenModel) DeletePersonal(userID int, id int64) error {
+	query := "DELETE FROM tokens WHERE id = $1 AND user_id = $2 AND token_type = $3"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := tm.DB.ExecContext(ctx, query, id, userID, TokenTypeAuthentication)
+	if err != nil {
+		return fmt.Errorf("in TokenModel#DeletePersonal: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in TokenModel#DeletePersonal: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// UsePersonal records the use of the token and returns its scopes.
+// ErrRecordNotFound is returned for unknown and expired tokens.
+func (tm TokenModel) UsePersonal(plainText string) (TokenScopes, error) {
+	query := `
+		UPDATE tokens
+		SET last_used_at = now()
+		WHERE hash = $1 AND token_type = $2 AND expired_at > now()
+		RETURNING scopes
+	`
+	hash := sha256.Sum256([]byte(plainText))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var scopes TokenScopes
+	if err := tm.DB.QueryRowContext(
+		ctx,
+		query,
+		hash[:],
+		TokenTypeAuthentication,
+	).Scan(&scopes); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("in TokenModel#UsePersonal: %w", err)
+		}
+	}
+	return scopes, nil
+}
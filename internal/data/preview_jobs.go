@@ -0,0 +1,184 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PreviewStatus tells whether preview image of the discussion
+// is already available.
+type PreviewStatus string
+
+const (
+	PreviewPending PreviewStatus = "pending"
+	PreviewFailed  PreviewStatus = "failed"
+	PreviewReady   PreviewStatus = "ready"
+)
+
+const (
+	// MaxPreviewJobAttempts is the number of times generating preview
+	// is tried before the job is marked as failed.
+	MaxPreviewJobAttempts = 3
+	// previewJobStaleAfter is the time after which running job is
+	// considered abandoned by a crashed worker and can be claimed again.
+	previewJobStaleAfter = "5 minutes"
+)
+
+type PreviewJob struct {
+	ID           int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DiscussionID int
+	Url          string
+	Attempts     int
+	LastError    string
+}
+
+type PreviewJobModel struct {
+	DB *sql.DB
+}
+
+// Claim locks the oldest runnable job for the calling worker.
+//
+// Jobs locked by other workers are skipped so multiple workers can
+// poll the queue concurrently. ErrRecordNotFound is returned when
+// there is nothing to do.
+func (pjm PreviewJobModel) Claim() (*PreviewJob, error) {
+	query := fmt.Sprintf(`
+		UPDATE
+			preview_jobs
+		SET
+			status = 'running',
+			attempts = attempts + 1,
+			updated_at = current_timestamp
+		WHERE id = (
+			SELECT id
+			FROM preview_jobs
+			WHERE
+				(status = 'pending' AND run_after <= now())
+				OR (status = 'running' AND updated_at < now() - INTERVAL '%s')
+			ORDER BY run_after
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, created_at, updated_at, discussion_id, url, attempts, last_error
+	`, previewJobStaleAfter)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var j PreviewJob
+	if err := pjm.DB.QueryRowContext(ctx, query).Scan(
+		&j.ID,
+		&j.CreatedAt,
+		&j.UpdatedAt,
+		&j.DiscussionID,
+		&j.Url,
+		&j.Attempts,
+		&j.LastError,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("in PreviewJobModel#Claim: %w", err)
+		}
+	}
+	return &j, nil
+}
+
+// Complete stores generated preview on the discussion and removes
+// the job from the queue. ErrRecordNotFound is returned when the
+// discussion was deleted in the meantime.
+func (pjm PreviewJobModel) Complete(job *PreviewJob, previewSrc string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := pjm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("in PreviewJobModel#Complete: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q := `
+		UPDATE discussions
+		SET preview_src = $1, preview_status = 'ready'
+		WHERE id = $2
+	`
+	res, err := tx.ExecContext(ctx, q, &previewSrc, &job.DiscussionID)
+	if err != nil {
+		return fmt.Errorf("in PreviewJobModel#Complete: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in PreviewJobModel#Complete: %w", err)
+	}
+	if rowsAffected == 0 {
+		err = ErrRecordNotFound
+		return err
+	}
+
+	q = "DELETE FROM preview_jobs WHERE id = $1"
+	if _, err = tx.ExecContext(ctx, q, &job.ID); err != nil {
+		return fmt.Errorf("in PreviewJobModel#Complete: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("in PreviewJobModel#Complete: %w", err)
+	}
+	return nil
+}
+
+// Fail records the reason of the failed attempt. The job is scheduled
+// again with linear backoff until it runs out of attempts, then both
+// the job and the preview of the discussion are marked as failed.
+func (pjm PreviewJobModel) Fail(job *PreviewJob, reason string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := pjm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("in PreviewJobModel#Fail: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if job.Attempts < MaxPreviewJobAttempts {
+		q := `
+			UPDATE preview_jobs
+			SET
+				status = 'pending',
+				last_error = $1,
+				updated_at = current_timestamp,
+				run_after = now() + $2 * INTERVAL '30 seconds'
+			WHERE id = $3
+		`
+		if _, err = tx.ExecContext(ctx, q, &reason, &job.Attempts, &job.ID); err != nil {
+			return fmt.Errorf("in PreviewJobModel#Fail: %w", err)
+		}
+	} else {
+		q := `
+			UPDATE preview_jobs
+			SET status = 'failed', last_error = $1, updated_at = current_timestamp
+			WHERE id = $2
+		`
+		if _, err = tx.ExecContext(ctx, q, &reason, &job.ID); err != nil {
+			return fmt.Errorf("in PreviewJobModel#Fail: %w", err)
+		}
+		q = "UPDATE discussions SET preview_status = 'failed' WHERE id = $1"
+		if _, err = tx.ExecContext(ctx, q, &job.DiscussionID); err != nil {
+			return fmt.Errorf("in PreviewJobModel#Fail: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("in PreviewJobModel#Fail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SessionModel writes sessions of the session manager together
+// with the user they belong to, so sessions of the user are
+// found without loading every session.
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// Commit stores the session the same way pgxstore does,
+// userID is 0 for sessions of guests.
+func (sm SessionModel) Commit(token string, b []byte, expiry time.Time, userID int) error {
+	q := `
+		INSERT INTO sessions (token, data, expiry, user_id)
+		VALUES ($1, $2, $3, NULLIF($4, 0))
+		ON CONFLICT (token) DO UPDATE
+		SET data = EXCLUDED.data, expiry = EXCLUDED.expiry, user_id = EXCLUDED.user_id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := sm.DB.ExecContext(ctx, q, token, b, expiry, userID); err != nil {
+		return fmt.Errorf("in SessionModel#Commit: %w", err)
+	}
+	return nil
+}
+
+// UserTokens returns tokens of unexpired sessions of the user.
+func (sm SessionModel) UserTokens(userID int) ([]string, error) {
+	q := "SELECT token FROM sessions WHERE user_id = $1 AND expiry > current_timestamp"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := sm.DB.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, fmt.Errorf("in SessionModel#UserTokens: %w", err)
+	}
+	defer rows.Close()
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, fmt.Errorf("in SessionModel#UserTokens: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("in SessionModel#UserTokens: %w", err)
+	}
+	return tokens, nil
+}
@@ -14,6 +14,8 @@ import (
 const (
 	TokenTypeActivation     = "activation"
 	TokenTypeAuthentication = "authentication"
+	TokenTypePasswordReset  = "password_reset"
+	TokenTypeEmailChange    = "email_change"
 )
 
 type (
@@ -25,6 +27,9 @@ type (
 		UserID    int
 		ExpiredAt time.Time
 		TokenType TokenType
+		// Name and Scopes are set only on personal access tokens.
+		Name   string
+		Scopes TokenScopes
 	}
 	TokenModel struct {
 		DB *sql.DB
@@ -36,6 +41,8 @@ var (
 	tokenTypesSet map[TokenType]void = map[TokenType]void{
 		TokenTypeAuthentication: member,
 		TokenTypeActivation:     member,
+		TokenTypePasswordReset:  member,
+		TokenTypeEmailChange:    member,
 	}
 )
 
@@ -82,9 +89,9 @@ func (tm TokenModel) New(userID int, lifeTime time.Duration, tokenType TokenType
 
 func (tm TokenModel) Insert(t *Token) error {
 	query := `
-		INSERT INTO tokens (hash, user_id, expired_at, token_type)
-		VALUES ($1, $2, $3, $4)`
-	args := []any{t.Hash, t.UserID, t.ExpiredAt, string(t.TokenType)}
+		INSERT INTO tokens (hash, user_id, expired_at, token_type, name, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	args := []any{t.Hash, t.UserID, t.ExpiredAt, string(t.TokenType), t.Name, t.Scopes}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	if _, err := tm.DB.ExecContext(ctx, query, args...); err != nil {
@@ -104,3 +111,28 @@ func (tm TokenModel) DeleteAllForUser(scope string, userID int) error {
 	}
 	return nil
 }
+
+// LastCreatedAt returns time at which the newest token of the given
+// type was created for the user. ErrRecordNotFound is returned when
+// the user has no such tokens.
+func (tm TokenModel) LastCreatedAt(scope string, userID int) (time.Time, error) {
+	query := `
+		SELECT created_at
+		FROM tokens
+		WHERE token_type = $1 AND user_id = $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var createdAt time.Time
+	if err := tm.DB.QueryRowContext(ctx, query, scope, userID).Scan(&createdAt); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, ErrRecordNotFound
+		default:
+			return time.Time{}, fmt.Errorf("in TokenModel#LastCreatedAt: %w", err)
+		}
+	}
+	return createdAt, nil
+}
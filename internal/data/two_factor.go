@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TwoFactor describes TOTP setup of the user. Secret is set
+// during the enrollment already, while Enabled becomes true
+// only after the first code is confirmed.
+type TwoFactor struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+func (tfm TwoFactorModel) Get(userID int) (*TwoFactor, error) {
+	query := `
+		SELECT COALESCE(totp_secret, ''), totp_enabled, totp_last_step
+		FROM users
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var tf TwoFactor
+	if err := tfm.DB.QueryRowContext(ctx, query, &userID).Scan(
+		&tf.Secret,
+		&tf.Enabled,
+		&tf.LastStep,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, fmt.Errorf("in TwoFactorModel#Get: %w", err)
+		}
+	}
+	return &tf, nil
+}
+
+// Required reports whether the user has to set up 2FA before doing
+// anything else. It is mandatory for administrators.
+func (tfm TwoFactorModel) Required(userID int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM users u JOIN roles r ON u.role_id = r.id
+			WHERE u.id = $1 AND r.name = 'admin' AND NOT u.totp_enabled
+		)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var required bool
+	if err := tfm.DB.QueryRowContext(ctx, query, &userID).Scan(&required); err != nil {
+		return false, fmt.Errorf("in TwoFactorModel#Required: %w", err)
+	}
+	return required, nil
+}
+
+// SetPendingSecret starts the enrollment. Secret of the user who
+// already enabled 2FA is never replaced, ErrEditConflict is returned.
+func (tfm TwoFactorModel) SetPendingSecret(userID int, secret string) error {
+	query := `
+		UPDATE users
+		SET totp_secret = $1, updated_at = current_timestamp
+		WHERE id = $2 AND NOT totp_enabled
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := tfm.DB.ExecContext(ctx, query, &secret, &userID)
+	if err != nil {
+		return fmt.Errorf("in TwoFactorModel#SetPendingSecret: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in TwoFactorModel#SetPendingSecret: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	return nil
+}
+
+// Enable finishes the enrollment and replaces recovery codes of the
+// user. Step of the code used for confirmation is marked as used.
+func (tfm TwoFactorModel) Enable(userID int, step int64, recoveryCodes []string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := tfm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("in TwoFactorModel#Enable: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q := `
+		UPDATE users
+		SET
+			totp_enabled = TRUE,
+			totp_last_step = $1,
+			updated_at = current_timestamp
+		WHERE id = $2 AND totp_secret IS NOT NULL AND NOT totp_enabled
+	`
+	res, err := tx.ExecContext(ctx, q, &step, &userID)
+	if err != nil {
+		return fmt.Errorf("in TwoFactorModel#Enable: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in TwoFactorModel#Enable: %w", err)
+	}
+	if rowsAffected == 0 {
+		err = ErrEditConflict
+		return err
+	}
+
+	q = "DELETE FROM recovery_codes WHERE user_id = $1"
+	if _, err = tx.ExecContext(ctx, q, &userID); err != nil {
+		return fmt.Errorf("in TwoFactorModel#Enable: %w", err)
+	}
+	q = "INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)"
+	for _, code := range recoveryCodes {
+		if _, err = tx.ExecContext(ctx, q, &userID, recoveryCodeHash(code)); err != nil {
+			return fmt.Errorf("in TwoFactorModel#Enable: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("in TwoFactorModel#Enable: %w", err)
+	}
+	return nil
+}
+
+// Disable removes the secret and all recovery codes of the user.
+func (tfm TwoFactorModel) Disable(userID int) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := tfm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("in TwoFactorModel#Disable: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q := `
+		UPDATE users
+		SET
+			totp_secret = NULL,
+			totp_enabled = FALSE,
+			totp_last_step = 0,
+			updated_at = current_timestamp
+		WHERE id = $1
+	`
+	if _, err = tx.ExecContext(ctx, q, &userID); err != nil {
+		return fmt.Errorf("in TwoFactorModel#Disable: %w", err)
+	}
+	q = "DELETE FROM recovery_codes WHERE user_id = $1"
+	if _, err = tx.ExecContext(ctx, q, &userID); err != nil {
+		return fmt.Errorf("in TwoFactorModel#Disable: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("in TwoFactorModel#Disable: %w", err)
+	}
+	return nil
+}
+
+// UseStep marks the time step of accepted code as used. False is
+// returned when the same or later step was used already, which
+// means the code is being replayed.
+func (tfm TwoFactorModel) UseStep(userID int, step int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_last_step = $1
+		WHERE id = $2 AND totp_last_step < $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := tfm.DB.ExecContext(ctx, query, &step, &userID)
+	if err != nil {
+		return false, fmt.Errorf("in TwoFactorModel#UseStep: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("in TwoFactorModel#UseStep: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode consumes the code. False is returned when
+// the code does not exist or was used before.
+func (tfm TwoFactorModel) UseRecoveryCode(userID int, code string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = current_timestamp
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := tfm.DB.ExecContext(ctx, query, &userID, recoveryCodeHash(code))
+	if err != nil {
+		return false, fmt.Errorf("in TwoFactorModel#UseRecoveryCode: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("in TwoFactorModel#UseRecoveryCode: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// RecoveryCodesLeft returns number of unused recovery codes.
+func (tfm TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM recovery_codes
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var left int
+	if err := tfm.DB.QueryRowContext(ctx, query, &userID).Scan(&left); err != nil {
+		return 0, fmt.Errorf("in TwoFactorModel#RecoveryCodesLeft: %w", err)
+	}
+	return left, nil
+}
+
+// recoveryCodeHash ignores case and whitespace users
+// tend to add while retyping the code.
+func recoveryCodeHash(code string) []byte {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
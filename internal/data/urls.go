@@ -0,0 +1,97 @@
+package data
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidUrl = errors.New("invalid url")
+
+// trackingParams lists query parameters which do not change
+// the resource the url points to. Parameters ending with "*"
+// are treated as prefixes.
+var trackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"mc_cid",
+	"mc_eid",
+	"igshid",
+	"yclid",
+	"_hsenc",
+	"_hsmi",
+	"ref_src",
+}
+
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, tp := range trackingParams {
+		if prefix, ok := strings.CutSuffix(tp, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+			continue
+		}
+		if name == tp {
+			return true
+		}
+	}
+	return false
+}
+
+// CanonicalizeUrl returns normalized form of the url used to detect
+// discussions sharing the same resource.
+//
+// Scheme is unified to https, host is lowercased and stripped of "www."
+// prefix and default port, trailing slashes, fragment and tracking query
+// parameters are removed and remaining parameters are sorted.
+func CanonicalizeUrl(rawUrl string) (string, error) {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", ErrInvalidUrl
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+	default:
+		return "", ErrInvalidUrl
+	}
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimSuffix(host, ".")
+	host = strings.TrimPrefix(host, "www.")
+	if host == "" {
+		return "", ErrInvalidUrl
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host = host + ":" + port
+	}
+
+	query := u.Query()
+	for name := range query {
+		if isTrackingParam(name) {
+			query.Del(name)
+		}
+	}
+	for name := range query {
+		sort.Strings(query[name])
+	}
+
+	canonical := url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     strings.TrimRight(u.Path, "/"),
+		RawQuery: query.Encode(),
+	}
+	return canonical.String(), nil
+}
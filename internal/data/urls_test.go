@@ -0,0 +1,88 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanonicalizeUrl(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"scheme unified to https", "http://example.com/a", "https://example.com/a"},
+		{"scheme case", "HTTPS://example.com/a", "https://example.com/a"},
+		{"missing scheme", "example.com/a", "https://example.com/a"},
+		{"surrounding spaces", "  https://example.com/a\n", "https://example.com/a"},
+		{"host case", "https://ExAmPle.COM/a", "https://example.com/a"},
+		{"path case kept", "https://example.com/A/b", "https://example.com/A/b"},
+		{"www prefix", "https://www.example.com/a", "https://example.com/a"},
+		{"trailing dot of host", "https://example.com./a", "https://example.com/a"},
+		{"default http port", "http://example.com:80/a", "https://example.com/a"},
+		{"default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"other port kept", "https://example.com:8080/a", "https://example.com:8080/a"},
+		{"ipv6 host", "http://[::1]:8080/a", "https://[::1]:8080/a"},
+		{"ipv6 host default port", "http://[::1]:80/a", "https://[::1]/a"},
+		{"trailing slash", "https://example.com/a/", "https://example.com/a"},
+		{"trailing slashes", "https://example.com/a//", "https://example.com/a"},
+		{"root path", "https://example.com/", "https://example.com"},
+		{"fragment", "https://example.com/a#section", "https://example.com/a"},
+		{"utm params", "https://example.com/a?utm_source=x&utm_medium=y", "https://example.com/a"},
+		{"tracking param case", "https://example.com/a?UTM_Campaign=x&FBCLID=y", "https://example.com/a"},
+		{"click ids", "https://example.com/a?gclid=1&msclkid=2&igshid=3", "https://example.com/a"},
+		{"params kept and sorted", "https://example.com/a?b=2&utm_source=x&a=1", "https://example.com/a?a=1&b=2"},
+		{"repeated param values sorted", "https://example.com/a?b=2&b=1", "https://example.com/a?b=1&b=2"},
+		{"escaped path", "https://example.com/a%20b", "https://example.com/a%20b"},
+		{
+			"everything at once",
+			"HTTP://WWW.Example.com:80/Path/?utm_source=x&z=1&a=2#top",
+			"https://example.com/Path?a=2&z=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalizeUrl(tt.url)
+			if err != nil {
+				t.Fatalf("CanonicalizeUrl(%q) returned error: %v", tt.url, err)
+			}
+			if got != tt.want {
+				t.Errorf("CanonicalizeUrl(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeUrlInvalid(t *testing.T) {
+	for _, rawUrl := range []string{
+		"ftp://example.com/a",
+		"javascript://alert(1)",
+		"mailto://someone@example.com",
+		"https://",
+		"https://:443/a",
+		"http://example.com:port/a",
+		"https://exa mple.com/a",
+	} {
+		if _, err := CanonicalizeUrl(rawUrl); !errors.Is(err, ErrInvalidUrl) {
+			t.Errorf("CanonicalizeUrl(%q) error = %v, want %v", rawUrl, err, ErrInvalidUrl)
+		}
+	}
+}
+
+func TestCanonicalizeUrlDuplicates(t *testing.T) {
+	same := []string{
+		"https://example.com/post?id=1",
+		"http://www.example.com/post/?id=1",
+		"example.com/post?id=1&utm_source=newsletter",
+		"HTTPS://EXAMPLE.COM:443/post?id=1#comments",
+	}
+	want, err := CanonicalizeUrl(same[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rawUrl := range same[1:] {
+		if got, err := CanonicalizeUrl(rawUrl); err != nil || got != want {
+			t.Errorf("CanonicalizeUrl(%q) = %q, %v, want %q", rawUrl, got, err, want)
+		}
+	}
+}
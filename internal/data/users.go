@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -53,6 +54,32 @@ func (um UserModel) HasRole(userId int, rolename string) (bool, error) {
 	return hasRole, nil
 }
 
+// Reputation is the sum of votes other users gave to comments of
+// the user and the number of upvotes of discussions the user started.
+func (um UserModel) Reputation(userId int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	q := `
+		SELECT
+			COALESCE((
+				SELECT SUM(v.value)
+				FROM upvotes v JOIN comments c ON c.id=v.comment_id
+				WHERE c.user_id=$1 AND v.user_id IS DISTINCT FROM $1
+			), 0)
+			+
+			(
+				SELECT COUNT(*)
+				FROM discussion_upvotes du JOIN discussions d ON d.id=du.discussion_id
+				WHERE d.user_id=$1 AND du.user_id IS DISTINCT FROM $1
+			)
+	`
+	var reputation int
+	if err := um.DB.QueryRowContext(ctx, q, &userId).Scan(&reputation); err != nil {
+		return 0, fmt.Errorf("in UserModel#Reputation: %w", err)
+	}
+	return reputation, nil
+}
+
 func (um UserModel) GetEmail(id int) (email string, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -104,6 +131,7 @@ func (um UserModel) GetForToken(scope string, plainTextToken string) (*User, err
 			u.email,
 			u.password_hash,
 			u.activated,
+			u.description,
 			u.version
 		FROM
 			users u
@@ -122,6 +150,7 @@ func (um UserModel) GetForToken(scope string, plainTextToken string) (*User, err
 		&u.Email,
 		&u.Password.hash,
 		&u.Activated,
+		&u.Description,
 		&u.Version,
 	); err != nil {
 		switch {
@@ -169,7 +198,7 @@ func (um UserModel) Insert(user *User) error {
 		&user.AvatarSrc,
 	); err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case isDuplicatedEmail(err):
 			return ErrDuplicatedEmail
 		default:
 			return err
@@ -261,6 +290,115 @@ func (um UserModel) AvatarSrcByID(id int) (string, error) {
 	return src, nil
 }
 
+// UpdateAvatar replaces avatar of the user
+// and returns the previous one.
+func (um UserModel) UpdateAvatar(id int, src string) (oldSrc string, err error) {
+	query := `
+		UPDATE
+			users u
+		SET
+			updated_at = current_timestamp,
+			avatar_src = $1,
+			version = u.version + 1
+		FROM
+			(SELECT id, COALESCE(avatar_src, '') AS avatar_src FROM users WHERE id = $2 FOR UPDATE) old
+		WHERE
+			u.id = old.id
+		RETURNING
+			old.avatar_src
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := um.DB.QueryRowContext(ctx, query, &src, &id).Scan(&oldSrc); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", fmt.Errorf("in UserModel#UpdateAvatar: %w", err)
+		}
+	}
+	return oldSrc, nil
+}
+
+// SetPendingEmail stores the address the user wants to switch to.
+// ErrDuplicatedEmail is returned when the address is already taken,
+// the check is repeated in ConfirmEmail.
+func (um UserModel) SetPendingEmail(id int, email string) error {
+	query := `
+		UPDATE
+			users
+		SET
+			updated_at = current_timestamp,
+			pending_email = $1
+		WHERE
+			id = $2
+			AND NOT EXISTS (SELECT 1 FROM users WHERE email = $1)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := um.DB.ExecContext(ctx, query, &email, &id)
+	if err != nil {
+		return fmt.Errorf("in UserModel#SetPendingEmail: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("in UserModel#SetPendingEmail: %w", err)
+	}
+	if rowsAffected == 0 {
+		exists, err := um.Exists(id)
+		if err != nil {
+			return fmt.Errorf("in UserModel#SetPendingEmail: %w", err)
+		}
+		if !exists {
+			return ErrRecordNotFound
+		}
+		return ErrDuplicatedEmail
+	}
+	return nil
+}
+
+// ConfirmEmail replaces email of the user with the pending one.
+// ErrRecordNotFound is returned when there is no pending email and
+// ErrDuplicatedEmail when someone took the address in the meantime.
+func (um UserModel) ConfirmEmail(id int) (oldEmail, newEmail string, err error) {
+	query := `
+		UPDATE
+			users u
+		SET
+			updated_at = current_timestamp,
+			email = u.pending_email,
+			pending_email = NULL,
+			version = u.version + 1
+		FROM
+			(SELECT id, email FROM users WHERE id = $1 FOR UPDATE) old
+		WHERE
+			u.id = old.id
+			AND u.pending_email IS NOT NULL
+		RETURNING
+			old.email, u.email
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := um.DB.QueryRowContext(ctx, query, &id).Scan(&oldEmail, &newEmail); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", "", ErrRecordNotFound
+		case isDuplicatedEmail(err):
+			return "", "", ErrDuplicatedEmail
+		default:
+			return "", "", fmt.Errorf("in UserModel#ConfirmEmail: %w", err)
+		}
+	}
+	return oldEmail, newEmail, nil
+}
+
+// isDuplicatedEmail reports whether err is the violation of the
+// case-insensitive unique constraint on users email.
+func isDuplicatedEmail(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.ConstraintName == "users_email_key"
+}
+
 func (um UserModel) Update(user *User) error {
 	query := `
 		UPDATE
@@ -291,7 +429,7 @@ func (um UserModel) Update(user *User) error {
 	defer cancel()
 	if err := um.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version); err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case isDuplicatedEmail(err):
 			return ErrDuplicatedEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
@@ -398,3 +536,66 @@ func (um UserModel) Banned(userId int) (bool, error) {
 	}
 	return banned, nil
 }
+
+func (um UserModel) Activated(userId int) (bool, error) {
+	q := "SELECT EXISTS(SELECT id FROM users WHERE activated=true AND id=$1)"
+	args := []any{&userId}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var activated bool
+	if err := um.DB.QueryRowContext(ctx, q, args...).Scan(&activated); err != nil {
+		return activated, fmt.Errorf("in UserModel#Activated: %w", err)
+	}
+	return activated, nil
+}
+
+// LockedUntil returns time until which the account is locked,
+// zero time is returned for accounts which are not locked.
+func (um UserModel) LockedUntil(id int) (time.Time, error) {
+	query := "SELECT locked_until FROM users WHERE id = $1 AND locked_until > now()"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var lockedUntil time.Time
+	if err := um.DB.QueryRowContext(ctx, query, &id).Scan(&lockedUntil); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, nil
+		default:
+			return time.Time{}, fmt.Errorf("in UserModel#LockedUntil: %w", err)
+		}
+	}
+	return lockedUntil, nil
+}
+
+// Lock locks the account until the given time. False is returned
+// when the account was already locked, so the owner is notified
+// about each lockout only once.
+func (um UserModel) Lock(id int, until time.Time) (bool, error) {
+	query := `
+		UPDATE users
+		SET locked_until = $1
+		WHERE id = $2 AND (locked_until IS NULL OR locked_until <= now())
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	res, err := um.DB.ExecContext(ctx, query, &until, &id)
+	if err != nil {
+		return false, fmt.Errorf("in UserModel#Lock: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("in UserModel#Lock: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// Unlock is used once the owner proves access to the email.
+func (um UserModel) Unlock(id int) error {
+	query := "UPDATE users SET locked_until = NULL WHERE id = $1"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := um.DB.ExecContext(ctx, query, &id); err != nil {
+		return fmt.Errorf("in UserModel#Unlock: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package mailer
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/a-h/templ"
@@ -10,15 +11,21 @@ import (
 
 const dialAndSendTries = 3
 
+type contextKey string
+
+const baseURLContextKey = contextKey("baseURL")
+
 type Mailer struct {
-	dialer *mail.Client
-	sender string
+	dialer  *mail.Client
+	sender  string
+	baseURL string
 }
 
 func New(
 	host string,
 	port int,
 	username, password, sender string,
+	baseURL string,
 	env string,
 ) Mailer {
 	var dialer *mail.Client
@@ -49,7 +56,18 @@ func New(
 		}
 		dialer = c
 	}
-	return Mailer{dialer: dialer, sender: sender}
+	return Mailer{
+		dialer:  dialer,
+		sender:  sender,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// link builds absolute url of the site path for the links in emails,
+// base url is put in the context templates are rendered with by Send.
+func link(ctx context.Context, path string) string {
+	baseURL, _ := ctx.Value(baseURLContextKey).(string)
+	return baseURL + path
 }
 
 func (m Mailer) Send(
@@ -68,11 +86,13 @@ func (m Mailer) Send(
 		return err
 	}
 
+	ctx := context.WithValue(context.Background(), baseURLContextKey, m.baseURL)
+
 	// Template for subject
 	subject := templ.GetBuffer()
 	defer templ.ReleaseBuffer(subject)
 	if err := subjectTemplate.Render(
-		context.Background(),
+		ctx,
 		subject,
 	); err != nil {
 		return err
@@ -83,8 +103,8 @@ func (m Mailer) Send(
 	plainBody := templ.GetBuffer()
 	defer templ.ReleaseBuffer(plainBody)
 	if err := plainBodyTemplate.Render(
-		context.Background(),
-		subject,
+		ctx,
+		plainBody,
 	); err != nil {
 		return err
 	}
@@ -93,7 +113,7 @@ func (m Mailer) Send(
 	// Template for html
 	html := templ.GetBuffer()
 	defer templ.ReleaseBuffer(html)
-	if err := htmlTemplate.Render(context.Background(), html); err != nil {
+	if err := htmlTemplate.Render(ctx, html); err != nil {
 		return err
 	}
 	msg.AddAlternativeString(mail.TypeTextHTML, html.String())
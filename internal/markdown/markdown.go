@@ -0,0 +1,147 @@
+// Package markdown renders Markdown written by users into HTML
+// which is safe to serve as it is.
+//
+// Raw HTML is omitted already by goldmark, the output is then
+// sanitized with the allowlist policy anyway, so no parser bug
+// or extension can introduce scripts into the page.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// linkRel is set on every link, content is not endorsed by
+// the site and the linked page must not get hold of it.
+const linkRel = "nofollow ugc noopener"
+
+// externalLinkClass marks links leaving the site,
+// they are opened in a new tab.
+const externalLinkClass = "external"
+
+// MaxLength is the maximum length of Markdown accepted from users,
+// longer one takes too long to highlight.
+const MaxLength = 4000
+
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(
+			extension.NewTable(
+				extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute),
+			),
+			extension.Strikethrough,
+			extension.Linkify,
+			extension.TaskList,
+			// Tokens get classes instead of inline styles, colors
+			// come from highlight.css served with other assets.
+			highlighting.NewHighlighting(
+				highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+			),
+		),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(util.Prioritized(linkAttributes{}, 100)),
+		),
+	)
+	policy = newPolicy()
+)
+
+// Render converts src into sanitized HTML.
+func Render(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		return "", fmt.Errorf("in markdown#Render: %w", err)
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// newPolicy allows only elements produced from Markdown and its GFM
+// extensions. Images are not allowed, so visitors are not tracked by
+// pixels from other sites.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements(
+		"p", "br", "hr",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"blockquote", "pre", "code", "em", "strong", "del",
+		"ul", "ol", "li", "a",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("class").
+		Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).
+		OnElements("code")
+	p.AllowAttrs("align").
+		Matching(regexp.MustCompile(`^(left|center|right)$`)).
+		OnElements("th", "td")
+
+	// Task list items
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").
+		Matching(regexp.MustCompile(`^$`)).
+		OnElements("input")
+
+	// Highlighted code blocks
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^chroma$`)).OnElements("pre")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-z0-9]{1,5}$`)).OnElements("span")
+
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowAttrs("rel").
+		Matching(regexp.MustCompile("^" + linkRel + "$")).
+		OnElements("a")
+	p.AllowAttrs("target").Matching(regexp.MustCompile(`^_blank$`)).OnElements("a")
+	p.AllowAttrs("class").
+		Matching(regexp.MustCompile("^" + externalLinkClass + "$")).
+		OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
+
+// linkAttributes sets rel of all links and marks external ones.
+type linkAttributes struct{}
+
+func (linkAttributes) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	src := reader.Source()
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var dest []byte
+		switch l := n.(type) {
+		case *ast.Link:
+			dest = l.Destination
+		case *ast.AutoLink:
+			dest = l.URL(src)
+		default:
+			return ast.WalkContinue, nil
+		}
+		n.SetAttributeString("rel", []byte(linkRel))
+		if isExternal(dest) {
+			n.SetAttributeString("target", []byte("_blank"))
+			n.SetAttributeString("class", []byte(externalLinkClass))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func isExternal(dest []byte) bool {
+	u, err := url.Parse(string(dest))
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
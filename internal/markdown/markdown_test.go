@@ -0,0 +1,207 @@
+package markdown
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// xssPayloads must not make it through Render into the output.
+var xssPayloads = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=//evil.example/xss.js></SCRIPT>`,
+	`<<script>script>alert(1)<</script>/script>`,
+	`<img src=x onerror=alert(1)>`,
+	`<svg onload=alert(1)><circle r=1 /></svg>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`<a href="&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;:alert(1)">click</a>`,
+	`<div style="background:url(javascript:alert(1))">styled</div>`,
+	`<style>@import 'https://evil.example/x.css';</style>`,
+	`<base href="https://evil.example/">`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<form action="javascript:alert(1)"><button>go</button></form>`,
+	`<details open ontoggle=alert(1)>`,
+	`<math><mi xlink:href="javascript:alert(1)">x</mi></math>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>`,
+	`<p onclick="alert(1)">paragraph</p>`,
+	`[click](javascript:alert(1))`,
+	`[click](JaVaScRiPt:alert(1))`,
+	`[click](  javascript:alert(1)  )`,
+	`[click](java&#x09;script:alert(1))`,
+	`[click](&#x6A;avascript:alert(1))`,
+	`[click](vbscript:msgbox(1))`,
+	`[click](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)`,
+	`[click][ref]
+
+[ref]: javascript:alert(1)`,
+	`<javascript:alert(1)>`,
+	`[click](https://example.com "title\" onmouseover=\"alert(1)")`,
+	`[click](https://example.com"onmouseover="alert(1))`,
+	`![image](javascript:alert(1))`,
+	`![x" onerror="alert(1)](https://example.com/x.png)`,
+	"```\"><script>alert(1)</script>\ncode\n```",
+	"``` onerror=alert(1)\ncode\n```",
+	"`<script>alert(1)</script>`",
+	`> <img src=x onerror=alert(1)>`,
+	`* <a href="javascript:alert(1)">item</a>`,
+	`# <svg/onload=alert(1)>`,
+	`&lt;script&gt;alert(1)&lt;/script&gt;`,
+	`<!-- --><script>alert(1)</script><!-- -->`,
+	`[<img src=x onerror=alert(1)>](https://example.com)`,
+	`| a | b |
+|---|---|
+| <script>alert(1)</script> | [x](javascript:alert(1)) |`,
+	`| <img src=x onerror=alert(1)> |
+|:---:|
+| cell |`,
+	`- [x] <img src=x onerror=alert(1)>
+- [ ] [x](javascript:alert(1))`,
+	`~~<script>alert(1)</script>~~`,
+	`www.example.com/"onmouseover="alert(1)`,
+	`https://example.com/<script>alert(1)</script>`,
+	`javascript:alert(1)`,
+	"```js\"><img src=x onerror=alert(1)>\nlet x = 1\n```",
+	"```html\n<script>alert(1)</script>\n```",
+	"```go\n// </code></pre><script>alert(1)</script>\n```",
+}
+
+// allowedAttrs lists attributes which may appear on elements of the
+// rendered HTML. It is kept apart from the policy on purpose, so
+// mistake in the policy is not repeated in the check.
+var allowedAttrs = map[string][]string{
+	"p": nil, "br": nil, "hr": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"blockquote": nil, "em": nil, "strong": nil, "del": nil,
+	"ul": nil, "li": nil,
+	"ol":    {"start"},
+	"pre":   {"class"},
+	"code":  {"class"},
+	"span":  {"class"},
+	"a":     {"href", "title", "rel", "target", "class"},
+	"table": nil, "thead": nil, "tbody": nil, "tr": nil,
+	"th":    {"align"},
+	"td":    {"align"},
+	"input": {"type", "checked", "disabled"},
+}
+
+// renderChecks make sure sanitizing does not break Markdown itself.
+var renderChecks = []struct {
+	src  string
+	want string
+}{
+	{"**bold** and _em_", "<strong>bold</strong> and <em>em</em>"},
+	{"```go\nx := 1\n```", `<pre class="chroma"><code><span class="line"><span class="cl"><span class="nx">x</span>`},
+	{"```\nplain\n```", "<pre><code>plain"},
+	{"~~gone~~", "<del>gone</del>"},
+	{"| a |\n|:-:|\n| b |", `<td align="center">b</td>`},
+	{"- [x] done", `<li><input checked="" disabled="" type="checkbox"> done</li>`},
+	{"www.example.com", `<a href="http://www.example.com" rel="` + linkRel + `" target="_blank" class="` + externalLinkClass + `">`},
+	{
+		"[site](https://example.com)",
+		`<a href="https://example.com" rel="` + linkRel + `" target="_blank" class="` + externalLinkClass + `">site</a>`,
+	},
+	{"[page](/discussions/1)", `<a href="/discussions/1" rel="` + linkRel + `">page</a>`},
+	{"<https://example.com>", `class="` + externalLinkClass + `">https://example.com</a>`},
+}
+
+func TestRenderSanitizesXSSPayloads(t *testing.T) {
+	for _, payload := range xssPayloads {
+		out, err := Render(payload)
+		if err != nil {
+			t.Errorf("Render(%q): %v", payload, err)
+			continue
+		}
+		if err := verify(out); err != nil {
+			t.Errorf("payload %q rendered as %q: %v", payload, out, err)
+		}
+	}
+}
+
+func TestRenderKeepsMarkdown(t *testing.T) {
+	for _, rc := range renderChecks {
+		out, err := Render(rc.src)
+		if err != nil {
+			t.Errorf("Render(%q): %v", rc.src, err)
+			continue
+		}
+		if !strings.Contains(out, rc.want) {
+			t.Errorf("%q rendered as %q, want %q in it", rc.src, out, rc.want)
+		}
+		if err := verify(out); err != nil {
+			t.Errorf("%q rendered as %q: %v", rc.src, out, err)
+		}
+	}
+}
+
+// verify parses rendered HTML and checks its elements, attributes
+// and urls against the allowlist.
+func verify(out string) error {
+	z := html.NewTokenizer(strings.NewReader(out))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return nil
+		case html.CommentToken, html.DoctypeToken:
+			return fmt.Errorf("unexpected %s", z.Token().String())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			allowed, ok := allowedAttrs[t.Data]
+			if !ok {
+				return fmt.Errorf("element %s is not allowed", t.Data)
+			}
+			for _, attr := range t.Attr {
+				if !contains(allowed, attr.Key) {
+					return fmt.Errorf("attribute %s of %s is not allowed", attr.Key, t.Data)
+				}
+				if attr.Key == "href" {
+					if err := verifyURL(attr.Val); err != nil {
+						return err
+					}
+				}
+				if attr.Key == "rel" && attr.Val != linkRel {
+					return fmt.Errorf("link has rel %q", attr.Val)
+				}
+			}
+			if t.Data == "a" && !hasAttr(t, "rel") {
+				return fmt.Errorf("link has no rel")
+			}
+		}
+	}
+}
+
+func verifyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("url %q can not be parsed", raw)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return nil
+	default:
+		return fmt.Errorf("url %q has scheme %s", raw, u.Scheme)
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttr(t html.Token, key string) bool {
+	for _, attr := range t.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
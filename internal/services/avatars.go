@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/N0tR1CH/sad/internal/storage"
+	"github.com/google/uuid"
+	"github.com/h2non/bimg"
+)
+
+const (
+	// MaxAvatarSize is the maximum size of the uploaded avatar in bytes.
+	MaxAvatarSize = 2 << 20
+	// maxAvatarPixels protects against decompression bombs, images
+	// small on disk which take gigabytes of memory once decoded.
+	maxAvatarPixels    = 24_000_000
+	maxAvatarDimension = 8000
+	minAvatarDimension = 32
+	// avatarLargestSize is the variant under which avatar is stored
+	// on the user, other variants are derived from its url.
+	avatarLargestSize = 256
+)
+
+// AvatarSizes lists widths, in pixels, of square variants
+// generated for every avatar.
+var AvatarSizes = []int{32, 64, avatarLargestSize}
+
+var (
+	ErrAvatarTooLarge    = errors.New("avatar file is too large")
+	ErrAvatarUnsupported = errors.New("avatar must be jpeg, png, gif or webp image")
+	ErrAvatarDimensions  = errors.New("avatar dimensions are out of bounds")
+	ErrAvatarNotStored   = errors.New("avatar is not in the storage")
+)
+
+// avatarMimeTypes are sniffed from the content, content type
+// declared by the client is not trusted.
+var avatarMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type AvatarService struct {
+	logger *slog.Logger
+	store  storage.Storage
+}
+
+// Save validates the uploaded image, crops it to square and stores it
+// in all AvatarSizes as webp without metadata, including EXIF.
+//
+// Returned url points to the largest variant, see AvatarVariant.
+func (as AvatarService) Save(r io.Reader) (string, error) {
+	buf, err := io.ReadAll(io.LimitReader(r, MaxAvatarSize+1))
+	if err != nil {
+		return "", fmt.Errorf("in AvatarService#Save: %w", err)
+	}
+	if len(buf) > MaxAvatarSize {
+		return "", ErrAvatarTooLarge
+	}
+	if !avatarMimeTypes[http.DetectContentType(buf)] {
+		return "", ErrAvatarUnsupported
+	}
+
+	// Only the header is read to get the size,
+	// image is not decoded at this point.
+	size, err := bimg.NewImage(buf).Size()
+	if err != nil {
+		return "", ErrAvatarUnsupported
+	}
+	if size.Width < minAvatarDimension ||
+		size.Height < minAvatarDimension ||
+		size.Width > maxAvatarDimension ||
+		size.Height > maxAvatarDimension ||
+		size.Width*size.Height > maxAvatarPixels {
+		return "", ErrAvatarDimensions
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := fmt.Sprintf("avatars/%s", uuid.NewString())
+	for _, s := range AvatarSizes {
+		// Crop keeps centre of the image. Orientation from EXIF
+		// is applied before the metadata is stripped.
+		variant, err := bimg.NewImage(buf).Process(bimg.Options{
+			Width:         s,
+			Height:        s,
+			Crop:          true,
+			Enlarge:       true,
+			Gravity:       bimg.GravityCentre,
+			Type:          bimg.WEBP,
+			Quality:       80,
+			StripMetadata: true,
+		})
+		if err != nil {
+			as.remove(ctx, dir)
+			return "", fmt.Errorf("in AvatarService#Save: %w", err)
+		}
+		if err := as.store.Put(
+			ctx,
+			fmt.Sprintf("%s/%d.webp", dir, s),
+			bytes.NewReader(variant),
+			int64(len(variant)),
+			"image/webp",
+		); err != nil {
+			as.remove(ctx, dir)
+			return "", fmt.Errorf("in AvatarService#Save: %w", err)
+		}
+	}
+	return as.store.URL(fmt.Sprintf("%s/%d.webp", dir, avatarLargestSize)), nil
+}
+
+// Remove deletes all variants of the avatar.
+// Urls not pointing into the storage are ignored.
+func (as AvatarService) Remove(src string) error {
+	key, ok := as.store.Key(src)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir, ok := strings.CutSuffix(key, fmt.Sprintf("/%d.webp", avatarLargestSize))
+	if !ok {
+		// Avatar uploaded before variants were introduced
+		return as.store.Delete(ctx, key)
+	}
+	return as.remove(ctx, dir)
+}
+
+// Read returns content of the avatar stored under src, that is
+// the largest variant. ErrAvatarNotStored is returned for urls
+// not pointing into the storage.
+func (as AvatarService) Read(src string) ([]byte, error) {
+	key, ok := as.store.Key(src)
+	if !ok {
+		return nil, ErrAvatarNotStored
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rc, err := as.store.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("in AvatarService#Read: %w", err)
+	}
+	defer rc.Close()
+	buf, err := io.ReadAll(io.LimitReader(rc, MaxAvatarSize))
+	if err != nil {
+		return nil, fmt.Errorf("in AvatarService#Read: %w", err)
+	}
+	return buf, nil
+}
+
+func (as AvatarService) remove(ctx context.Context, dir string) error {
+	var errs []error
+	for _, s := range AvatarSizes {
+		key := fmt.Sprintf("%s/%d.webp", dir, s)
+		if err := as.store.Delete(ctx, key); err != nil {
+			as.logger.Error("AVATARSERVICE", "err", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AvatarVariant returns url of the avatar in the given size.
+// Avatars without variants are returned as they are.
+func AvatarVariant(src string, size int) string {
+	largest := fmt.Sprintf("/%d.webp", avatarLargestSize)
+	if base, ok := strings.CutSuffix(src, largest); ok {
+		return fmt.Sprintf("%s/%d.webp", base, size)
+	}
+	return src
+}
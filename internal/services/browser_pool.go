@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// browserMetrics is published under /debug/vars.
+//
+// Average time spent waiting for a free tab can be derived
+// from tab_wait_ms_total divided by tabs_acquired.
+var browserMetrics = expvar.NewMap("chromedp")
+
+// browserPool shares single long-lived headless browser between
+// screenshots. Each screenshot gets its own tab and the number of
+// tabs opened at once is bounded.
+//
+// Browser is launched lazily and launched again whenever the
+// previous process crashed or lost its connection. All its traffic
+// goes through the guard proxy.
+type browserPool struct {
+	logger *slog.Logger
+	tabs   chan struct{}
+
+	mu         sync.Mutex
+	proxy      *guardProxy
+	browserCtx context.Context
+	cancel     context.CancelFunc
+}
+
+func newBrowserPool(logger *slog.Logger, maxTabs int) *browserPool {
+	if maxTabs < 1 {
+		maxTabs = 1
+	}
+	return &browserPool{
+		logger: logger,
+		tabs:   make(chan struct{}, maxTabs),
+	}
+}
+
+// tab waits for a free slot and opens new tab in the browser.
+//
+// ctx only bounds the time spent waiting, callers are expected
+// to set their own deadline on the returned tab context.
+// Release must be called once the tab is no longer needed.
+func (bp *browserPool) tab(ctx context.Context) (
+	tabCtx context.Context,
+	release func(),
+	err error,
+) {
+	start := time.Now()
+	select {
+	case bp.tabs <- struct{}{}:
+	case <-ctx.Done():
+		browserMetrics.Add("tab_wait_timeouts", 1)
+		return nil, nil, ctx.Err()
+	}
+	browserMetrics.Add("tabs_acquired", 1)
+	browserMetrics.Add("tab_wait_ms_total", time.Since(start).Milliseconds())
+
+	browserCtx, err := bp.browser()
+	if err != nil {
+		<-bp.tabs
+		return nil, nil, err
+	}
+
+	browserMetrics.Add("tabs_in_use", 1)
+	tabCtx, cancel := chromedp.NewContext(browserCtx)
+	release = func() {
+		// Cancelling context of the tab closes it
+		// without touching the browser itself.
+		cancel()
+		browserMetrics.Add("tabs_in_use", -1)
+		<-bp.tabs
+	}
+	return tabCtx, release, nil
+}
+
+// browser returns context of the running browser,
+// launching it first when needed.
+func (bp *browserPool) browser() (context.Context, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if bp.browserCtx != nil && bp.browserCtx.Err() == nil {
+		return bp.browserCtx, nil
+	}
+	if bp.browserCtx != nil {
+		// Context of the browser is cancelled by chromedp
+		// as soon as the connection with the process is lost.
+		bp.logger.Warn("CHROMEDPSERVICE", "msg", "browser crashed, restarting")
+		browserMetrics.Add("browser_restarts", 1)
+		bp.cancel()
+	}
+
+	if bp.proxy == nil {
+		proxy, err := newGuardProxy(bp.logger)
+		if err != nil {
+			return nil, err
+		}
+		bp.proxy = proxy
+	}
+
+	allocCtx, allocCancel := chromedp.NewExecAllocator(
+		context.Background(),
+		append(
+			chromedp.DefaultExecAllocatorOptions[:],
+			chromedp.ProxyServer(bp.proxy.url()),
+			// Loopback is not proxied by default
+			chromedp.Flag("proxy-bypass-list", "<-loopback>"),
+		)...,
+	)
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx)
+	cancel := func() {
+		browserCancel()
+		allocCancel()
+	}
+	// Running no actions launches the browser process.
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancel()
+		bp.browserCtx, bp.cancel = nil, nil
+		return nil, err
+	}
+	bp.browserCtx, bp.cancel = browserCtx, cancel
+	bp.logger.Info("CHROMEDPSERVICE", "msg", "browser launched")
+	return browserCtx, nil
+}
+
+// close shuts the browser and the proxy down. Both are
+// launched again if a tab is requested afterwards.
+func (bp *browserPool) close() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if bp.cancel != nil {
+		bp.cancel()
+		bp.browserCtx, bp.cancel = nil, nil
+	}
+	if bp.proxy != nil {
+		bp.proxy.close()
+		bp.proxy = nil
+	}
+}
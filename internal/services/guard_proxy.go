@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// maxTunnelDuration bounds the time https connection of the
+// browser is kept open, screenshots take much less.
+const maxTunnelDuration = time.Minute
+
+// guardProxy is a forward proxy the browser sends all its traffic
+// through. The browser does not resolve hosts by itself then, they are
+// resolved and connected to by the guarded dialer, so the address the
+// page is loaded from is always the checked one.
+type guardProxy struct {
+	logger   *slog.Logger
+	dialer   *net.Dialer
+	forward  *httputil.ReverseProxy
+	listener net.Listener
+	server   *http.Server
+}
+
+// newGuardProxy starts the proxy on a random loopback port.
+func newGuardProxy(logger *slog.Logger) (*guardProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	dialer := guardedDialer(3 * time.Second)
+	gp := &guardProxy{
+		logger:   logger,
+		dialer:   dialer,
+		listener: listener,
+		forward: &httputil.ReverseProxy{
+			// Requests sent to the proxy already have absolute urls
+			Rewrite: func(*httputil.ProxyRequest) {},
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 3 * time.Second,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     30 * time.Second,
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				logger.Warn("CHROMEDPSERVICE", "msg", "request blocked", "url", r.URL.String(), "err", err)
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		},
+	}
+	gp.server = &http.Server{
+		Handler:           gp,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := gp.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("CHROMEDPSERVICE", "err", err)
+		}
+	}()
+	return gp, nil
+}
+
+// url under which the browser reaches the proxy.
+func (gp *guardProxy) url() string {
+	return "http://" + gp.listener.Addr().String()
+}
+
+func (gp *guardProxy) close() {
+	_ = gp.server.Close()
+}
+
+func (gp *guardProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		gp.tunnel(w, r)
+		return
+	}
+	if r.URL.Scheme != "http" || !allowedPorts[r.URL.Port()] {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	gp.forward.ServeHTTP(w, r)
+}
+
+// tunnel connects the browser with the host of https url.
+func (gp *guardProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	_, port, err := net.SplitHostPort(r.Host)
+	if err != nil || !allowedPorts[port] {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	upstream, err := gp.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		gp.logger.Warn("CHROMEDPSERVICE", "msg", "request blocked", "host", r.Host, "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		gp.logger.Error("CHROMEDPSERVICE", "err", err)
+		return
+	}
+	defer client.Close()
+
+	deadline := time.Now().Add(maxTunnelDuration)
+	_ = client.SetDeadline(deadline)
+	_ = upstream.SetDeadline(deadline)
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Bytes sent right after the request may already be buffered
+		_, _ = io.Copy(upstream, buf.Reader)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		done <- struct{}{}
+	}()
+	// Either side closing ends the tunnel, deferred
+	// closes unblock the other copy.
+	<-done
+}
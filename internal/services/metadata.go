@@ -0,0 +1,384 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/N0tR1CH/sad/internal/storage"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// maxMetadataBodySize limits the amount of the page read while
+	// looking for metadata. It is usually found within the head.
+	maxMetadataBodySize  = 1 << 20
+	maxMetadataRedirects = 5
+	// maxMetadataFieldLen is the number of runes kept of each field.
+	maxMetadataFieldLen = 500
+	// Images of the page larger than that are not stored.
+	maxMetadataImageSize   = 2 << 20
+	maxMetadataFaviconSize = 256 << 10
+)
+
+// metadataImageExts maps sniffed types of images which are stored
+// to extensions. SVG is left out, it can carry scripts.
+var metadataImageExts = map[string]string{
+	"image/png":    ".png",
+	"image/jpeg":   ".jpg",
+	"image/gif":    ".gif",
+	"image/webp":   ".webp",
+	"image/x-icon": ".ico",
+}
+
+var ErrNoMetadata = errors.New("page has no metadata")
+
+// PageMetadata describes the page as its authors want it to be
+// presented when shared, mostly based on the OpenGraph protocol.
+//
+// All urls are absolute.
+type PageMetadata struct {
+	Title        string
+	Description  string
+	ImageUrl     string
+	SiteName     string
+	FaviconUrl   string
+	CanonicalUrl string
+}
+
+type MetadataService struct {
+	logger   *slog.Logger
+	client   *http.Client
+	urlGuard UrlGuardService
+	store    storage.Storage
+}
+
+func newMetadataService(
+	logger *slog.Logger,
+	urlGuard UrlGuardService,
+	store storage.Storage,
+) MetadataService {
+	dialer := guardedDialer(3 * time.Second)
+	return MetadataService{
+		logger:   logger,
+		urlGuard: urlGuard,
+		store:    store,
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 3 * time.Second,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     30 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxMetadataRedirects {
+					return errors.New("too many redirects")
+				}
+				return urlGuard.check(req.Context(), req.URL.String())
+			},
+		},
+	}
+}
+
+// Fetch downloads the page and extracts its metadata. Urls of the
+// image and favicon point to the page, see StoreImages.
+func (ms MetadataService) Fetch(rawUrl string) (*PageMetadata, error) {
+	if err := ms.urlGuard.Check(rawUrl); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("in MetadataService#Fetch: %w", err)
+	}
+	req.Header.Set("User-Agent", "SadBot/1.0 (+https://sad.dev)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	res, err := ms.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("in MetadataService#Fetch: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"in MetadataService#Fetch: unexpected status %d",
+			res.StatusCode,
+		)
+	}
+	contentType := res.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" &&
+		mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("in MetadataService#Fetch: %w", ErrNoMetadata)
+	}
+
+	body, err := charset.NewReader(
+		io.LimitReader(res.Body, maxMetadataBodySize),
+		contentType,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("in MetadataService#Fetch: %w", err)
+	}
+
+	// Relative urls are resolved against the url
+	// of the page after following redirects.
+	meta := parseMetadata(body, res.Request.URL)
+	if meta.Title == "" && meta.Description == "" && meta.ImageUrl == "" {
+		return nil, fmt.Errorf("in MetadataService#Fetch: %w", ErrNoMetadata)
+	}
+	return meta, nil
+}
+
+// StoreImages copies image and favicon of the page into the storage
+// and points the metadata to the copies, so viewers do not load them
+// from third parties. Urls of images which could not be stored are
+// cleared.
+func (ms MetadataService) StoreImages(meta *PageMetadata) {
+	meta.ImageUrl = ms.storeImage(meta.ImageUrl, maxMetadataImageSize)
+	meta.FaviconUrl = ms.storeImage(meta.FaviconUrl, maxMetadataFaviconSize)
+}
+
+func (ms MetadataService) storeImage(rawUrl string, maxSize int) string {
+	if rawUrl == "" {
+		return ""
+	}
+	src, err := ms.downloadImage(rawUrl, maxSize)
+	if err != nil {
+		ms.logger.Info("METADATASERVICE", "msg", "image not stored", "url", rawUrl, "err", err)
+		return ""
+	}
+	return src
+}
+
+func (ms MetadataService) downloadImage(rawUrl string, maxSize int) (string, error) {
+	if err := ms.urlGuard.Check(rawUrl); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return "", fmt.Errorf("in MetadataService#downloadImage: %w", err)
+	}
+	req.Header.Set("User-Agent", "SadBot/1.0 (+https://sad.dev)")
+	req.Header.Set("Accept", "image/*")
+
+	res, err := ms.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("in MetadataService#downloadImage: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"in MetadataService#downloadImage: unexpected status %d",
+			res.StatusCode,
+		)
+	}
+	buf, err := io.ReadAll(io.LimitReader(res.Body, int64(maxSize)+1))
+	if err != nil {
+		return "", fmt.Errorf("in MetadataService#downloadImage: %w", err)
+	}
+	if len(buf) > maxSize {
+		return "", errors.New("in MetadataService#downloadImage: image is too large")
+	}
+	// Declared type is not trusted, the image is served
+	// under the type sniffed from its content.
+	contentType := http.DetectContentType(buf)
+	ext, ok := metadataImageExts[contentType]
+	if !ok {
+		return "", fmt.Errorf(
+			"in MetadataService#downloadImage: unsupported type %s",
+			contentType,
+		)
+	}
+
+	key := fmt.Sprintf("metadata/%s%s", uuid.NewString(), ext)
+	if err := ms.store.Put(
+		ctx,
+		key,
+		bytes.NewReader(buf),
+		int64(len(buf)),
+		contentType,
+	); err != nil {
+		return "", fmt.Errorf("in MetadataService#downloadImage: %w", err)
+	}
+	return ms.store.URL(key), nil
+}
+
+// RemoveImages deletes images stored by StoreImages.
+// Urls not pointing into the storage are ignored.
+func (ms MetadataService) RemoveImages(srcs ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var errs []error
+	for _, src := range srcs {
+		key, ok := ms.store.Key(src)
+		if !ok {
+			continue
+		}
+		if err := ms.store.Delete(ctx, key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("in MetadataService#RemoveImages: %w", err)
+	}
+	return nil
+}
+
+// parseMetadata scans the head of the document. OpenGraph properties
+// take precedence over the title and description of the page.
+func parseMetadata(r io.Reader, base *url.URL) *PageMetadata {
+	var (
+		meta         PageMetadata
+		title        string
+		description  string
+		inTitle      bool
+		favicon      string
+		touchIcon    string
+		canonicalUrl string
+	)
+
+	z := html.NewTokenizer(r)
+loop:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			break loop
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(val)
+			}
+			switch string(name) {
+			case "body":
+				break loop
+			case "title":
+				inTitle = tt == html.StartTagToken
+			case "meta":
+				content := attrs["content"]
+				key := attrs["property"]
+				if key == "" {
+					key = attrs["name"]
+				}
+				switch strings.ToLower(key) {
+				case "og:title":
+					meta.Title = content
+				case "og:description":
+					meta.Description = content
+				case "og:image", "og:image:url", "og:image:secure_url":
+					if meta.ImageUrl == "" {
+						meta.ImageUrl = resolveUrl(base, content)
+					}
+				case "og:site_name":
+					meta.SiteName = content
+				case "og:url":
+					if canonicalUrl == "" {
+						canonicalUrl = resolveUrl(base, content)
+					}
+				case "description":
+					description = content
+				}
+			case "link":
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					switch rel {
+					case "icon":
+						if favicon == "" {
+							favicon = resolveUrl(base, attrs["href"])
+						}
+					case "apple-touch-icon":
+						if touchIcon == "" {
+							touchIcon = resolveUrl(base, attrs["href"])
+						}
+					case "canonical":
+						// Canonical link is more reliable than og:url
+						if href := resolveUrl(base, attrs["href"]); href != "" {
+							canonicalUrl = href
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if meta.Title == "" {
+		meta.Title = title
+	}
+	if meta.Description == "" {
+		meta.Description = description
+	}
+	switch {
+	case favicon != "":
+		meta.FaviconUrl = favicon
+	case touchIcon != "":
+		meta.FaviconUrl = touchIcon
+	default:
+		meta.FaviconUrl = resolveUrl(base, "/favicon.ico")
+	}
+	meta.CanonicalUrl = canonicalUrl
+	if meta.SiteName == "" {
+		meta.SiteName = strings.TrimPrefix(base.Hostname(), "www.")
+	}
+
+	for _, field := range []*string{
+		&meta.Title,
+		&meta.Description,
+		&meta.SiteName,
+	} {
+		*field = Truncate(strings.Join(strings.Fields(*field), " "), maxMetadataFieldLen)
+	}
+	return &meta
+}
+
+// resolveUrl returns absolute url of the reference. Only http
+// and https urls are returned, others are dropped.
+func resolveUrl(base *url.URL, ref string) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	if s := u.String(); len(s) <= 2048 {
+		return s
+	}
+	return ""
+}
+
+// Truncate shortens s to at most n runes.
+func Truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -1,13 +1,19 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
+	"net"
 	"time"
 
+	"github.com/N0tR1CH/sad/internal/storage"
+	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 	"github.com/google/uuid"
 	"github.com/h2non/bimg"
@@ -16,27 +22,85 @@ import (
 type Services struct {
 	ChromeDp interface {
 		GenScreenshot(url string) (string, error)
+		RemoveScreenshot(resPath string) error
+		Close()
+	}
+	UrlGuard interface {
+		Check(rawUrl string) error
+	}
+	Metadata interface {
+		Fetch(rawUrl string) (*PageMetadata, error)
+		StoreImages(meta *PageMetadata)
+		RemoveImages(srcs ...string) error
+	}
+	Avatars interface {
+		Save(r io.Reader) (string, error)
+		Remove(src string) error
+		Read(src string) ([]byte, error)
+	}
+	TwoFactor interface {
+		Enroll(accountName string) (*TwoFactorEnrollment, error)
+		Validate(secret, code string) (step int64, ok bool)
+		RecoveryCodes() ([]string, error)
 	}
 }
 
-func NewServices(logger *slog.Logger) Services {
+// NewServices creates services of the application.
+//
+// maxTabs limits number of screenshots taken concurrently.
+func NewServices(
+	logger *slog.Logger,
+	maxTabs int,
+	store storage.Storage,
+) Services {
+	urlGuard := UrlGuardService{resolver: net.DefaultResolver}
 	return Services{
 		ChromeDp: ChromeDpService{
-			logger,
+			logger:   logger,
+			browsers: newBrowserPool(logger, maxTabs),
+			urlGuard: urlGuard,
+			store:    store,
 		},
+		UrlGuard:  urlGuard,
+		Metadata:  newMetadataService(logger, urlGuard, store),
+		Avatars:   AvatarService{logger: logger, store: store},
+		TwoFactor: TwoFactorService{},
 	}
 }
 
 type ChromeDpService struct {
-	logger *slog.Logger
+	logger   *slog.Logger
+	browsers *browserPool
+	urlGuard UrlGuardService
+	store    storage.Storage
 }
 
+// GenScreenshot takes screenshot of the page and returns url
+// under which it is publicly available.
+//
+// Every request made by the page, including redirects, goes
+// through the url guard so the browser never reaches internal
+// network on behalf of the user. Hosts are resolved by the guard
+// proxy of the browser pool which checks the address once again
+// right before connecting.
 func (cds ChromeDpService) GenScreenshot(url string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := cds.urlGuard.Check(url); err != nil {
+		cds.logger.Error("CHROMEDPSERVICE", "err", err)
+		return "", err
+	}
+	waitCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	ctx, cancel = chromedp.NewContext(ctx)
+	tabCtx, release, err := cds.browsers.tab(waitCtx)
+	if err != nil {
+		cds.logger.Error("CHROMEDPSERVICE", "err", err)
+		return "", err
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(tabCtx, 10*time.Second)
 	defer cancel()
 
+	chromedp.ListenTarget(ctx, cds.guardRequests(ctx))
+
 	var buf []byte
 
 	if err := chromedp.Run(ctx, mobileScreenshot(url, &buf)); err != nil {
@@ -44,40 +108,93 @@ func (cds ChromeDpService) GenScreenshot(url string) (string, error) {
 		return "", err
 	}
 
-	resPath := fmt.Sprintf("/public/%s.webp", uuid.NewString())
-	filepath := fmt.Sprintf("cmd/web%s", resPath)
-	if err := os.WriteFile(filepath, buf, 0o644); err != nil {
+	imgConvertedToWebp, err := bimg.NewImage(buf).Convert(bimg.WEBP)
+	if err != nil {
 		cds.logger.Error("CHROMEDPSERVICE", "err", err)
 		return "", err
 	}
 
-	buffer, err := bimg.Read(filepath)
+	imgCompressed, err := bimg.NewImage(imgConvertedToWebp).Process(
+		bimg.Options{Quality: 1},
+	)
 	if err != nil {
 		cds.logger.Error("CHROMEDPSERVICE", "err", err)
 		return "", err
 	}
 
-	imgConvertedToWebp, err := bimg.NewImage(buffer).Convert(bimg.WEBP)
-	if err != nil {
+	key := fmt.Sprintf("previews/%s.webp", uuid.NewString())
+	storeCtx, storeCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer storeCancel()
+	if err := cds.store.Put(
+		storeCtx,
+		key,
+		bytes.NewReader(imgCompressed),
+		int64(len(imgCompressed)),
+		"image/webp",
+	); err != nil {
 		cds.logger.Error("CHROMEDPSERVICE", "err", err)
 		return "", err
 	}
 
-	imgCompressed, err := bimg.NewImage(imgConvertedToWebp).Process(
-		bimg.Options{Quality: 1},
-	)
-	if err != nil {
-		cds.logger.Error("CHROMEDPSERVICE", "err", err)
-		return "", err
+	return cds.store.URL(key), nil
+}
+
+// guardRequests returns listener failing paused requests
+// of the tab which target unsafe urls.
+func (cds ChromeDpService) guardRequests(ctx context.Context) func(ev interface{}) {
+	return func(ev interface{}) {
+		e, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		// Listeners must not block, so requests are
+		// resolved in separate goroutines.
+		go func() {
+			execCtx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+			if err := cds.urlGuard.check(ctx, e.Request.URL); err != nil {
+				cds.logger.Warn(
+					"CHROMEDPSERVICE",
+					"msg", "request blocked",
+					"url", e.Request.URL,
+					"err", err,
+				)
+				_ = fetch.FailRequest(
+					e.RequestID,
+					network.ErrorReasonBlockedByClient,
+				).Do(execCtx)
+				return
+			}
+			_ = fetch.ContinueRequest(e.RequestID).Do(execCtx)
+		}()
 	}
+}
 
-	bimg.Write(filepath, imgCompressed)
+// Close shuts down the browser shared by screenshots.
+func (cds ChromeDpService) Close() {
+	cds.browsers.close()
+}
 
-	return resPath, nil
+// RemoveScreenshot deletes preview image previously generated by GenScreenshot.
+//
+// Urls that do not point into the storage are ignored.
+func (cds ChromeDpService) RemoveScreenshot(resPath string) error {
+	key, ok := cds.store.Key(resPath)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := cds.store.Delete(ctx, key); err != nil {
+		cds.logger.Error("CHROMEDPSERVICE", "err", err)
+		return err
+	}
+	return nil
 }
 
 func mobileScreenshot(urlstr string, res *[]byte) chromedp.Tasks {
 	return chromedp.Tasks{
+		// Pauses every request until guardRequests lets it through
+		fetch.Enable(),
 		chromedp.Navigate(urlstr),
 		chromedp.EmulateViewport(
 			1920,
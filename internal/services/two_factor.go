@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	totpIssuer = "SAD"
+	totpPeriod = 30
+	// totpSkew is the number of periods before and after the current
+	// one in which codes are still accepted, it covers clock drift.
+	totpSkew = 1
+	// RecoveryCodesCount is the number of codes generated on enrollment.
+	RecoveryCodesCount = 10
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// TwoFactorEnrollment holds the secret shown to the user
+// while setting up the authenticator app.
+type TwoFactorEnrollment struct {
+	Secret string
+	// QRCode is png image of the otpauth:// url encoded as data url,
+	// so the secret never leaves the server in any other request.
+	QRCode string
+}
+
+// TwoFactorService implements RFC 6238 time-based one-time passwords.
+type TwoFactorService struct{}
+
+// Enroll generates new secret for the account.
+func (tfs TwoFactorService) Enroll(accountName string) (*TwoFactorEnrollment, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: accountName,
+		Period:      totpPeriod,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("in TwoFactorService#Enroll: %w", err)
+	}
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, fmt.Errorf("in TwoFactorService#Enroll: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("in TwoFactorService#Enroll: %w", err)
+	}
+	return &TwoFactorEnrollment{
+		Secret: key.Secret(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// Validate checks the code against the secret. Time step in which
+// the code was generated is returned, so callers can refuse codes
+// already used once.
+func (tfs TwoFactorService) Validate(secret, code string) (step int64, ok bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpOpts.Digits.Length() {
+		return 0, false
+	}
+	now := time.Now().UTC()
+	for i := -totpSkew; i <= totpSkew; i++ {
+		t := now.Add(time.Duration(i*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, t, totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// RecoveryCodes generates single-use codes letting the user
+// log in without the authenticator app.
+func (tfs TwoFactorService) RecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("in TwoFactorService#RecoveryCodes: %w", err)
+		}
+		s := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		codes[i] = s[:8] + "-" + s[8:16]
+	}
+	return codes, nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// UnsafeUrlError is returned for urls the screenshot service
+// must not visit. Reason is safe to be shown to the user.
+type UnsafeUrlError struct {
+	Reason string
+}
+
+func (e *UnsafeUrlError) Error() string {
+	return "unsafe url: " + e.Reason
+}
+
+var (
+	allowedSchemes = map[string]bool{"http": true, "https": true}
+	allowedPorts   = map[string]bool{"": true, "80": true, "443": true, "8080": true, "8443": true}
+
+	// blockedPrefixes lists special purpose ranges which are not covered
+	// by the netip.Addr helpers used in checkAddr.
+	blockedPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+		netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+		netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+		netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+		netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+		netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+		netip.MustParsePrefix("198.51.100.0/24"), // documentation
+		netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+		netip.MustParsePrefix("240.0.0.0/4"),     // reserved
+		netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+		netip.MustParsePrefix("100::/64"),        // discard-only
+		netip.MustParsePrefix("2001::/32"),       // Teredo
+		netip.MustParsePrefix("2001:db8::/32"),   // documentation
+		netip.MustParsePrefix("2002::/16"),       // 6to4
+		netip.MustParsePrefix("fec0::/10"),       // site-local
+	}
+)
+
+// UrlGuardService decides whether the url can be visited
+// by the server without exposing internal network.
+type UrlGuardService struct {
+	resolver *net.Resolver
+}
+
+// Check rejects urls with schemes or ports other than the allowed ones
+// and urls whose host resolves to loopback, private, link-local or other
+// non-public address. Every resolved address has to be public, otherwise
+// the browser might pick the internal one.
+func (ugs UrlGuardService) Check(rawUrl string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return ugs.check(ctx, rawUrl)
+}
+
+func (ugs UrlGuardService) check(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return &UnsafeUrlError{Reason: "url is malformed"}
+	}
+	if !allowedSchemes[strings.ToLower(u.Scheme)] {
+		return &UnsafeUrlError{Reason: "only http and https links are allowed"}
+	}
+	if u.User != nil {
+		return &UnsafeUrlError{Reason: "links with credentials are not allowed"}
+	}
+	if !allowedPorts[u.Port()] {
+		return &UnsafeUrlError{
+			Reason: fmt.Sprintf("port %s is not allowed", u.Port()),
+		}
+	}
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	if host == "" {
+		return &UnsafeUrlError{Reason: "link has no host"}
+	}
+	if strings.EqualFold(host, "localhost") ||
+		strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return &UnsafeUrlError{Reason: "link points to a private network"}
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return checkAddr(addr)
+	}
+	addrs, err := ugs.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return &UnsafeUrlError{Reason: "host could not be resolved"}
+	}
+	for _, addr := range addrs {
+		if err := checkAddr(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guardedDialer returns dialer checking the address right before
+// connecting to it. Hosts are resolved again once the url guard checked
+// them, so this is what protects against hosts which resolve to a
+// different address the second time (DNS rebinding).
+func guardedDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			return checkAddr(addr)
+		},
+	}
+}
+
+func checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return &UnsafeUrlError{Reason: "link points to a private network"}
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return &UnsafeUrlError{Reason: "link points to a reserved address"}
+		}
+	}
+	return nil
+}
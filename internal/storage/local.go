@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects in the directory served by the application,
+// suitable for development and single instance deployments.
+type Local struct {
+	dir     string
+	baseUrl string
+}
+
+// NewLocal creates storage keeping objects in dir
+// which is served under baseUrl, e.g. "/public".
+func NewLocal(dir, baseUrl string) Local {
+	return Local{dir: dir, baseUrl: strings.TrimSuffix(baseUrl, "/")}
+}
+
+func (l Local) Put(
+	_ context.Context,
+	key string,
+	r io.Reader,
+	_ int64,
+	_ string,
+) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("in Local#Put: %w", err)
+	}
+
+	// Object is written aside and renamed, so it is
+	// never served partially written.
+	f, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("in Local#Put: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("in Local#Put: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("in Local#Put: %w", err)
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return fmt.Errorf("in Local#Put: %w", err)
+	}
+	if err := os.Rename(f.Name(), dst); err != nil {
+		return fmt.Errorf("in Local#Put: %w", err)
+	}
+	return nil
+}
+
+func (l Local) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("in Local#Get: %w", err)
+	}
+	return f, nil
+}
+
+func (l Local) Delete(_ context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("in Local#Delete: %w", err)
+	}
+	return nil
+}
+
+func (l Local) URL(key string) string {
+	return l.baseUrl + "/" + key
+}
+
+func (l Local) Key(url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, l.baseUrl+"/")
+	if !ok {
+		return "", false
+	}
+	key, err := cleanKey(key)
+	return key, err == nil
+}
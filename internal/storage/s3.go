@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores objects in a bucket of any S3 compatible service,
+// e.g. AWS S3 or MinIO. Bucket has to allow anonymous reads.
+type S3 struct {
+	client  *minio.Client
+	bucket  string
+	baseUrl string
+}
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// PublicUrl under which objects of the bucket are served,
+	// e.g. CDN in front of it. Defaults to the bucket url.
+	PublicUrl string
+}
+
+func NewS3(cfg S3Config) (S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return S3{}, fmt.Errorf("in storage#NewS3: %w", err)
+	}
+	baseUrl := cfg.PublicUrl
+	if baseUrl == "" {
+		scheme := "http"
+		if cfg.UseSSL {
+			scheme = "https"
+		}
+		baseUrl = fmt.Sprintf("%s://%s/%s", scheme, cfg.Endpoint, cfg.Bucket)
+	}
+	return S3{
+		client:  client,
+		bucket:  cfg.Bucket,
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+	}, nil
+}
+
+func (s S3) Put(
+	ctx context.Context,
+	key string,
+	r io.Reader,
+	size int64,
+	contentType string,
+) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.PutObject(
+		ctx,
+		s.bucket,
+		key,
+		r,
+		size,
+		minio.PutObjectOptions{
+			ContentType:  contentType,
+			CacheControl: "public, max-age=31536000, immutable",
+		},
+	); err != nil {
+		return fmt.Errorf("in S3#Put: %w", err)
+	}
+	return nil
+}
+
+func (s S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("in S3#Get: %w", err)
+	}
+	// Object is fetched lazily, stat reveals whether it exists
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("in S3#Get: %w", err)
+	}
+	return obj, nil
+}
+
+func (s S3) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(
+		ctx,
+		s.bucket,
+		key,
+		minio.RemoveObjectOptions{},
+	); err != nil {
+		return fmt.Errorf("in S3#Delete: %w", err)
+	}
+	return nil
+}
+
+func (s S3) URL(key string) string {
+	return s.baseUrl + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+func (s S3) Key(rawUrl string) (string, bool) {
+	escaped, ok := strings.CutPrefix(rawUrl, s.baseUrl+"/")
+	if !ok {
+		return "", false
+	}
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", false
+	}
+	key, err = cleanKey(key)
+	return key, err == nil
+}
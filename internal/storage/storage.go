@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Storage keeps blobs, like discussion previews and avatars, under keys
+// such as "avatars/<uuid>.webp". Objects are publicly readable under
+// the url returned by URL.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns address under which object is served.
+	URL(key string) string
+	// Key is the inverse of URL. False is returned for urls
+	// not pointing into the storage.
+	Key(url string) (string, bool)
+}
+
+// cleanKey rejects keys escaping the storage root.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,28 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/discussions/:id/edit","method":"GET"},{"path":"/discussions/:id","method":"PUT"},{"path":"/discussions/:id","method":"DELETE"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name='user';
+
+ALTER TABLE IF EXISTS reports
+    DROP CONSTRAINT IF EXISTS reports_comment_id_fkey,
+    ADD CONSTRAINT reports_comment_id_fkey
+        FOREIGN KEY (comment_id) REFERENCES comments(id),
+    DROP CONSTRAINT IF EXISTS reports_discussion_id_fkey,
+    ADD CONSTRAINT reports_discussion_id_fkey
+        FOREIGN KEY (discussion_id) REFERENCES discussions(id);
+
+ALTER TABLE IF EXISTS upvotes
+    DROP CONSTRAINT IF EXISTS upvotes_comment_id_fkey,
+    ADD CONSTRAINT upvotes_comment_id_fkey
+        FOREIGN KEY (comment_id) REFERENCES comments(id);
+
+ALTER TABLE IF EXISTS comments
+    DROP CONSTRAINT IF EXISTS comments_discussion_id_fkey,
+    ADD CONSTRAINT comments_discussion_id_fkey
+        FOREIGN KEY (discussion_id) REFERENCES discussions(id);
+
+ALTER TABLE IF EXISTS discussions
+    DROP COLUMN IF EXISTS version;
@@ -0,0 +1,26 @@
+ALTER TABLE IF EXISTS discussions
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- Deleting a discussion removes its comments (and their upvotes) while
+-- reports stay for moderators with the reference cleared.
+ALTER TABLE IF EXISTS comments
+    DROP CONSTRAINT IF EXISTS comments_discussion_id_fkey,
+    ADD CONSTRAINT comments_discussion_id_fkey
+        FOREIGN KEY (discussion_id) REFERENCES discussions(id) ON DELETE CASCADE;
+
+ALTER TABLE IF EXISTS upvotes
+    DROP CONSTRAINT IF EXISTS upvotes_comment_id_fkey,
+    ADD CONSTRAINT upvotes_comment_id_fkey
+        FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE;
+
+ALTER TABLE IF EXISTS reports
+    DROP CONSTRAINT IF EXISTS reports_discussion_id_fkey,
+    ADD CONSTRAINT reports_discussion_id_fkey
+        FOREIGN KEY (discussion_id) REFERENCES discussions(id) ON DELETE SET NULL,
+    DROP CONSTRAINT IF EXISTS reports_comment_id_fkey,
+    ADD CONSTRAINT reports_comment_id_fkey
+        FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE SET NULL;
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/discussions/:id/edit","method":"GET"},{"path":"/discussions/:id","method":"PUT"},{"path":"/discussions/:id","method":"DELETE"}]'::JSONB
+WHERE name='user';
@@ -0,0 +1,16 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/discussions/:id/upvote","method":"POST"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name='user';
+
+DROP INDEX IF EXISTS idx_discussions_num_upvotes;
+
+DROP INDEX IF EXISTS idx_discussions_created_at;
+
+ALTER TABLE IF EXISTS discussions
+    DROP COLUMN IF EXISTS num_upvotes;
+
+DROP TABLE IF EXISTS discussion_upvotes;
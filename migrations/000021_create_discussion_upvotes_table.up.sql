@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS discussion_upvotes (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    discussion_id INTEGER NOT NULL REFERENCES discussions(id) ON DELETE CASCADE,
+    UNIQUE(user_id, discussion_id)
+);
+
+-- Number of upvotes is denormalized so that ranking does not need to
+-- aggregate discussion_upvotes for every listed discussion.
+ALTER TABLE IF EXISTS discussions
+    ADD COLUMN IF NOT EXISTS num_upvotes INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_discussions_created_at
+ON discussions(created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_discussions_num_upvotes
+ON discussions(num_upvotes DESC, created_at DESC);
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/discussions/:id/upvote","method":"POST"}]'::JSONB
+WHERE name='user';
@@ -0,0 +1,17 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/search","method":"GET"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name IN ('user', 'guest');
+
+DROP INDEX IF EXISTS idx_comments_search_vector;
+
+ALTER TABLE IF EXISTS comments
+    DROP COLUMN IF EXISTS search_vector;
+
+DROP INDEX IF EXISTS idx_discussions_search_vector;
+
+ALTER TABLE IF EXISTS discussions
+    DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,22 @@
+ALTER TABLE IF EXISTS discussions
+    ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+        GENERATED ALWAYS AS (
+            setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+            setweight(to_tsvector('english', coalesce(description, '')), 'B')
+        ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_discussions_search_vector
+ON discussions USING GIN (search_vector);
+
+ALTER TABLE IF EXISTS comments
+    ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+        GENERATED ALWAYS AS (
+            to_tsvector('english', coalesce(content, ''))
+        ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector
+ON comments USING GIN (search_vector);
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/search","method":"GET"}]'::JSONB
+WHERE name IN ('user', 'guest');
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS discussions_canonical_url_key;
+
+ALTER TABLE IF EXISTS discussions
+    DROP COLUMN IF EXISTS canonical_url;
@@ -0,0 +1,7 @@
+-- Canonical form of the url is computed by the application. Discussions
+-- created before this migration are backfilled when the server starts.
+ALTER TABLE IF EXISTS discussions
+    ADD COLUMN IF NOT EXISTS canonical_url TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS discussions_canonical_url_key
+ON discussions(canonical_url);
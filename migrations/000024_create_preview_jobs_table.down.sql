@@ -0,0 +1,16 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/discussions/:id/preview","method":"GET"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name IN ('user', 'guest');
+
+DROP TABLE IF EXISTS preview_jobs;
+
+DROP TYPE IF EXISTS preview_job_status;
+
+ALTER TABLE IF EXISTS discussions
+    DROP COLUMN IF EXISTS preview_status;
+
+DROP TYPE IF EXISTS preview_status;
@@ -0,0 +1,28 @@
+CREATE TYPE preview_status AS ENUM ('pending', 'failed', 'ready');
+
+ALTER TABLE IF EXISTS discussions
+    ADD COLUMN IF NOT EXISTS preview_status PREVIEW_STATUS NOT NULL DEFAULT 'ready';
+
+CREATE TYPE preview_job_status AS ENUM ('pending', 'running', 'failed');
+
+-- Jobs are claimed by workers with FOR UPDATE SKIP LOCKED and deleted
+-- once the preview is generated.
+CREATE TABLE IF NOT EXISTS preview_jobs (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    updated_at TIMESTAMPTZ DEFAULT current_timestamp,
+    discussion_id INTEGER NOT NULL REFERENCES discussions(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    status PREVIEW_JOB_STATUS NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    run_after TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    UNIQUE(discussion_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_preview_jobs_status_run_after
+ON preview_jobs(status, run_after);
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/discussions/:id/preview","method":"GET"}]'::JSONB
+WHERE name IN ('user', 'guest');
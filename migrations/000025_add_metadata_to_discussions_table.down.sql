@@ -0,0 +1,7 @@
+ALTER TABLE IF EXISTS discussions
+    DROP COLUMN IF EXISTS meta_title,
+    DROP COLUMN IF EXISTS meta_description,
+    DROP COLUMN IF EXISTS meta_image_url,
+    DROP COLUMN IF EXISTS meta_site_name,
+    DROP COLUMN IF EXISTS meta_favicon_url,
+    DROP COLUMN IF EXISTS meta_canonical_url;
@@ -0,0 +1,7 @@
+ALTER TABLE IF EXISTS discussions
+    ADD COLUMN IF NOT EXISTS meta_title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS meta_description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS meta_image_url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS meta_site_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS meta_favicon_url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS meta_canonical_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/:id/avatar/edit","method":"GET"},{"path":"/users/:id/avatar","method":"PUT"}]'::JSONB
+WHERE name = 'user';
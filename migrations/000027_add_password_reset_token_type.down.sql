@@ -0,0 +1,16 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/users/password/forgot","method":"GET"},{"path":"/users/password/forgot","method":"POST"},{"path":"/users/password/reset","method":"GET"},{"path":"/users/password/reset","method":"POST"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name IN ('user', 'guest');
+
+DELETE FROM tokens WHERE token_type = 'password_reset';
+
+-- Values can not be removed from enum, so the type is recreated
+ALTER TYPE token_type RENAME TO token_type_old;
+CREATE TYPE token_type AS ENUM ('activation', 'authentication');
+ALTER TABLE tokens
+    ALTER COLUMN token_type TYPE token_type USING token_type::TEXT::token_type;
+DROP TYPE token_type_old;
@@ -0,0 +1,5 @@
+ALTER TYPE token_type ADD VALUE IF NOT EXISTS 'password_reset';
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/password/forgot","method":"GET"},{"path":"/users/password/forgot","method":"POST"},{"path":"/users/password/reset","method":"GET"},{"path":"/users/password/reset","method":"POST"}]'::JSONB
+WHERE name IN ('user', 'guest');
@@ -0,0 +1,18 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/users/:id/email/edit","method":"GET"},{"path":"/users/:id/email","method":"PUT"},{"path":"/users/email/confirm","method":"GET"},{"path":"/users/email/confirm","method":"PUT"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name IN ('user', 'guest');
+
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
+
+DELETE FROM tokens WHERE token_type = 'email_change';
+
+-- Values can not be removed from enum, so the type is recreated
+ALTER TYPE token_type RENAME TO token_type_old;
+CREATE TYPE token_type AS ENUM ('activation', 'authentication', 'password_reset');
+ALTER TABLE tokens
+    ALTER COLUMN token_type TYPE token_type USING token_type::TEXT::token_type;
+DROP TYPE token_type_old;
@@ -0,0 +1,14 @@
+ALTER TYPE token_type ADD VALUE IF NOT EXISTS 'email_change';
+
+-- New address is kept aside until it is confirmed with the token
+-- mailed to it, uniqueness is checked once again on confirmation.
+ALTER TABLE users ADD COLUMN pending_email TEXT COLLATE case_insensitive;
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/:id/email/edit","method":"GET"},{"path":"/users/:id/email","method":"PUT"}]'::JSONB
+WHERE name = 'user';
+
+-- Link from the email can be opened without being logged in
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/email/confirm","method":"GET"},{"path":"/users/email/confirm","method":"PUT"}]'::JSONB
+WHERE name IN ('user', 'guest');
@@ -0,0 +1,9 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/users/activation","method":"POST"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name = 'user';
+
+ALTER TABLE tokens DROP COLUMN IF EXISTS created_at;
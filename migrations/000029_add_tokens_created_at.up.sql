@@ -0,0 +1,6 @@
+-- Time of creation is used to throttle resending of activation emails
+ALTER TABLE tokens ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/activation","method":"POST"}]'::JSONB
+WHERE name = 'user';
@@ -0,0 +1,14 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/users/2fa","method":"GET"},{"path":"/users/2fa","method":"POST"},{"path":"/users/2fa","method":"DELETE"},{"path":"/users/2fa/verify","method":"GET"},{"path":"/users/2fa/verify","method":"POST"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name IN ('user', 'guest');
+
+DROP TABLE IF EXISTS recovery_codes;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_secret,
+    DROP COLUMN IF EXISTS totp_enabled,
+    DROP COLUMN IF EXISTS totp_last_step;
@@ -0,0 +1,25 @@
+-- Secret is stored as soon as the enrollment starts, but it is
+-- required on login only after the first code is confirmed.
+ALTER TABLE users
+    ADD COLUMN totp_secret TEXT,
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Time step of the last accepted code, codes can not be reused
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash BYTEA NOT NULL,
+    used_at TIMESTAMPTZ,
+    UNIQUE(user_id, hash)
+);
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/2fa","method":"GET"},{"path":"/users/2fa","method":"POST"},{"path":"/users/2fa","method":"DELETE"}]'::JSONB
+WHERE name = 'user';
+
+-- Second step of the login happens before the user is logged in
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/2fa/verify","method":"GET"},{"path":"/users/2fa/verify","method":"POST"}]'::JSONB
+WHERE name = 'guest';
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+
+DROP TABLE IF EXISTS login_attempts;
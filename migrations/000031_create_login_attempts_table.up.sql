@@ -0,0 +1,16 @@
+-- Audit log of login attempts, failed ones are also counted
+-- to slow down guessing of passwords.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    email TEXT NOT NULL COLLATE case_insensitive,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ip TEXT NOT NULL,
+    success BOOLEAN NOT NULL,
+    reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_email_created_at_idx ON login_attempts (email, created_at);
+CREATE INDEX IF NOT EXISTS login_attempts_ip_created_at_idx ON login_attempts (ip, created_at);
+
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMPTZ;
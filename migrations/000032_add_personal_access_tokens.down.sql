@@ -0,0 +1,15 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/users/tokens","method":"GET"},{"path":"/users/tokens","method":"POST"},{"path":"/users/tokens/:id","method":"DELETE"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name = 'user';
+
+DELETE FROM tokens WHERE token_type = 'authentication';
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS id,
+    DROP COLUMN IF EXISTS name,
+    DROP COLUMN IF EXISTS scopes,
+    DROP COLUMN IF EXISTS last_used_at;
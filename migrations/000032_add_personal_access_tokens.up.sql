@@ -0,0 +1,11 @@
+-- Personal access tokens use the 'authentication' token type,
+-- they are listed and revoked by id since the hash is secret.
+ALTER TABLE tokens
+    ADD COLUMN id BIGINT GENERATED ALWAYS AS IDENTITY UNIQUE,
+    ADD COLUMN name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN scopes JSONB NOT NULL DEFAULT '[]'::JSONB,
+    ADD COLUMN last_used_at TIMESTAMPTZ;
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/tokens","method":"GET"},{"path":"/users/tokens","method":"POST"},{"path":"/users/tokens/:id","method":"DELETE"}]'::JSONB
+WHERE name = 'user';
@@ -0,0 +1,15 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/api/v1/discussions","method":"GET"},{"path":"/api/v1/discussions/:id","method":"GET"},{"path":"/api/v1/discussions/:id/comments","method":"GET"},{"path":"/api/v1/comments/:id/replies","method":"GET"},{"path":"/api/v1/users/:id","method":"GET"},{"path":"/api/v1/categories","method":"GET"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name IN ('user', 'guest');
+
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/api/v1/discussions","method":"POST"},{"path":"/api/v1/discussions/:id/comments","method":"POST"},{"path":"/api/v1/reports","method":"POST"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name = 'user';
@@ -0,0 +1,9 @@
+-- Reading the JSON API is public like the HTML pages, posting
+-- requires an account. Listing reports stays with admins.
+UPDATE roles
+SET permissions = permissions || '[{"path":"/api/v1/discussions","method":"GET"},{"path":"/api/v1/discussions/:id","method":"GET"},{"path":"/api/v1/discussions/:id/comments","method":"GET"},{"path":"/api/v1/comments/:id/replies","method":"GET"},{"path":"/api/v1/users/:id","method":"GET"},{"path":"/api/v1/categories","method":"GET"}]'::JSONB
+WHERE name IN ('user', 'guest');
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/api/v1/discussions","method":"POST"},{"path":"/api/v1/discussions/:id/comments","method":"POST"},{"path":"/api/v1/reports","method":"POST"}]'::JSONB
+WHERE name = 'user';
@@ -0,0 +1,3 @@
+UPDATE roles
+SET permissions = permissions || '[{"path":"/api/openapi.json","method":"GET"}]'::JSONB
+WHERE name IN ('user', 'guest');
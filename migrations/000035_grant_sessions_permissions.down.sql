@@ -0,0 +1,7 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/users/sessions","method":"GET"},{"path":"/users/sessions","method":"DELETE"},{"path":"/users/sessions/:id","method":"DELETE"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name = 'user';
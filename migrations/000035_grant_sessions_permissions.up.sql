@@ -0,0 +1,3 @@
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/sessions","method":"GET"},{"path":"/users/sessions","method":"DELETE"},{"path":"/users/sessions/:id","method":"DELETE"}]'::JSONB
+WHERE name = 'user';
@@ -0,0 +1,37 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/users/data","method":"GET"},{"path":"/users/data/export","method":"POST"},{"path":"/users/data/export/:id","method":"GET"},{"path":"/users/data/deletion","method":"POST"},{"path":"/users/data/deletion","method":"DELETE"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name = 'user';
+
+DELETE FROM reports WHERE user_id IS NULL OR reported_user_id IS NULL;
+ALTER TABLE reports
+    DROP CONSTRAINT IF EXISTS reports_user_id_fkey,
+    ADD CONSTRAINT reports_user_id_fkey
+        FOREIGN KEY (user_id) REFERENCES users(id),
+    ALTER COLUMN user_id SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS reports_reported_user_id_fkey,
+    ADD CONSTRAINT reports_reported_user_id_fkey
+        FOREIGN KEY (reported_user_id) REFERENCES users(id),
+    ALTER COLUMN reported_user_id SET NOT NULL;
+
+DELETE FROM upvotes WHERE user_id IS NULL;
+ALTER TABLE upvotes
+    DROP CONSTRAINT IF EXISTS upvotes_user_id_fkey,
+    ADD CONSTRAINT upvotes_user_id_fkey
+        FOREIGN KEY (user_id) REFERENCES users(id);
+
+DELETE FROM comments WHERE user_id IS NULL;
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS comments_user_id_fkey,
+    ADD CONSTRAINT comments_user_id_fkey
+        FOREIGN KEY (user_id) REFERENCES users(id),
+    ALTER COLUMN user_id SET NOT NULL;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deletion_scheduled_at;
+
+DROP TABLE IF EXISTS data_exports;
+DROP TYPE IF EXISTS data_export_status;
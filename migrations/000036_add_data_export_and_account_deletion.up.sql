@@ -0,0 +1,47 @@
+CREATE TYPE data_export_status AS ENUM ('pending', 'ready', 'failed');
+
+-- Archives hold personal data, so unlike previews and avatars
+-- they are kept out of the public storage.
+CREATE TABLE IF NOT EXISTS data_exports (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status DATA_EXPORT_STATUS NOT NULL DEFAULT 'pending',
+    archive BYTEA,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id_created_at
+ON data_exports(user_id, created_at DESC);
+
+-- Account is deleted once the time passes, until then
+-- the user can cancel the deletion.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMPTZ;
+
+-- Comments and votes outlive deleted accounts without their author.
+-- Reports filed by or against them are kept as moderation evidence.
+ALTER TABLE comments
+    ALTER COLUMN user_id DROP NOT NULL,
+    DROP CONSTRAINT IF EXISTS comments_user_id_fkey,
+    ADD CONSTRAINT comments_user_id_fkey
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE upvotes
+    DROP CONSTRAINT IF EXISTS upvotes_user_id_fkey,
+    ADD CONSTRAINT upvotes_user_id_fkey
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE reports
+    ALTER COLUMN user_id DROP NOT NULL,
+    DROP CONSTRAINT IF EXISTS reports_user_id_fkey,
+    ADD CONSTRAINT reports_user_id_fkey
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    ALTER COLUMN reported_user_id DROP NOT NULL,
+    DROP CONSTRAINT IF EXISTS reports_reported_user_id_fkey,
+    ADD CONSTRAINT reports_reported_user_id_fkey
+        FOREIGN KEY (reported_user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/users/data","method":"GET"},{"path":"/users/data/export","method":"POST"},{"path":"/users/data/export/:id","method":"GET"},{"path":"/users/data/deletion","method":"POST"},{"path":"/users/data/deletion","method":"DELETE"}]'::JSONB
+WHERE name = 'user';
@@ -0,0 +1,3 @@
+UPDATE roles
+SET permissions = permissions || '[{"path":"/markdown/preview","method":"POST"}]'::JSONB
+WHERE name = 'user';
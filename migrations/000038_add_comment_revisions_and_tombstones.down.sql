@@ -0,0 +1,16 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/discussions/:discussionId/comments/:id","method":"GET"},{"path":"/discussions/:discussionId/comments/:id/edit","method":"GET"},{"path":"/discussions/:discussionId/comments/:id","method":"PUT"},{"path":"/discussions/:discussionId/comments/:id","method":"DELETE"},{"path":"/discussions/:discussionId/comments/:id/revisions","method":"GET"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name = 'user';
+
+DROP TABLE IF EXISTS comment_revisions;
+
+-- Deleting tombstones would remove their replies as well.
+UPDATE comments SET content = '[deleted]' WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE IF EXISTS comments
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,20 @@
+-- Deleted comments stay in the tree as tombstones, so their replies are kept.
+ALTER TABLE IF EXISTS comments
+    ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ NULL DEFAULT NULL,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ NULL DEFAULT NULL;
+
+-- Previous contents of edited comments, created_at is the time
+-- the content was replaced.
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    id INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    content TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_revisions_comment_id
+ON comment_revisions (comment_id);
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/discussions/:discussionId/comments/:id","method":"GET"},{"path":"/discussions/:discussionId/comments/:id/edit","method":"GET"},{"path":"/discussions/:discussionId/comments/:id","method":"PUT"},{"path":"/discussions/:discussionId/comments/:id","method":"DELETE"},{"path":"/discussions/:discussionId/comments/:id/revisions","method":"GET"}]'::JSONB
+WHERE name = 'user';
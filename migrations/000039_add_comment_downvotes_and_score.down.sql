@@ -0,0 +1,17 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/discussions/:discussionId/comments/:id/downvote","method":"POST"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name = 'user';
+
+DROP INDEX IF EXISTS idx_comments_discussion_id_score;
+
+ALTER TABLE IF EXISTS comments
+    DROP COLUMN IF EXISTS score;
+
+DELETE FROM upvotes WHERE value < 0;
+
+ALTER TABLE IF EXISTS upvotes
+    DROP COLUMN IF EXISTS value;
@@ -0,0 +1,18 @@
+-- Votes of comments, 1 for upvote and -1 for downvote.
+ALTER TABLE IF EXISTS upvotes
+    ADD COLUMN IF NOT EXISTS value SMALLINT NOT NULL DEFAULT 1
+        CONSTRAINT upvotes_value_check CHECK (value IN (-1, 1));
+
+-- Sum of votes of the comment, updated in the same transaction as votes.
+ALTER TABLE IF EXISTS comments
+    ADD COLUMN IF NOT EXISTS score INTEGER NOT NULL DEFAULT 0;
+
+UPDATE comments c
+SET score = (SELECT COUNT(*) FROM upvotes v WHERE v.comment_id = c.id);
+
+CREATE INDEX IF NOT EXISTS idx_comments_discussion_id_score
+ON comments (discussion_id, score DESC, id DESC);
+
+UPDATE roles
+SET permissions = permissions || '[{"path":"/discussions/:discussionId/comments/:id/downvote","method":"POST"}]'::JSONB
+WHERE name = 'user';
@@ -0,0 +1,7 @@
+UPDATE roles
+SET permissions = (
+    SELECT COALESCE(jsonb_agg(elem), '[]'::JSONB)
+    FROM jsonb_array_elements(permissions) AS elem
+    WHERE NOT '[{"path":"/discussions/new/title","method":"GET"}]'::JSONB @> jsonb_build_array(elem)
+)
+WHERE name IN ('user', 'guest');
@@ -0,0 +1,7 @@
+ALTER TABLE sessions ADD COLUMN user_id INTEGER;
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- User of existing sessions is only known to the encoded data,
+-- they are ended instead and users log in once again.
+DELETE FROM sessions;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_discussions_hot_score;
+
+ALTER TABLE IF EXISTS discussions
+    DROP COLUMN IF EXISTS hot_score;
@@ -0,0 +1,15 @@
+-- Hot score is refreshed periodically by the server, so listing hot
+-- discussions is served by the index and pages do not shift between
+-- the refreshes.
+ALTER TABLE IF EXISTS discussions
+    ADD COLUMN IF NOT EXISTS hot_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+UPDATE discussions
+SET hot_score = num_upvotes / POWER(
+    EXTRACT(EPOCH FROM (now() - created_at)) / 3600 + 2,
+    1.8
+)
+WHERE created_at > now() - INTERVAL '30 days';
+
+CREATE INDEX IF NOT EXISTS idx_discussions_hot_score
+ON discussions(hot_score DESC, id DESC);
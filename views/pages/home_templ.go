@@ -99,7 +99,15 @@ func HomeBody() templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<div id=\"category-buttons\" class=\"flex center justify-center py-4 md:py-8 flex-wrap gap-x-2\" hx-get=\"/categories\" hx-trigger=\"load\" hx-swap=\"innerHTML\"><!-- Buttons with categories to filter out discussions --></div><section id=\"discussion-cards\" class=\"grid grid-cols-2 md:grid-cols-3 gap-4 mt-4\" hx-get=\"/discussions\" hx-trigger=\"load\" hx-swap=\"innerHTML\"></section>")
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<div id=\"category-buttons\" class=\"flex center justify-center py-4 md:py-8 flex-wrap gap-x-2\" hx-get=\"/categories\" hx-trigger=\"load\" hx-swap=\"innerHTML\"><!-- Buttons with categories to filter out discussions --></div>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = components.DiscussionSortSelect("hot").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("<section id=\"discussion-cards\" class=\"grid grid-cols-2 md:grid-cols-3 gap-4 mt-4\" hx-get=\"/discussions\" hx-trigger=\"load\" hx-swap=\"innerHTML\"></section>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -1,7 +1,9 @@
 package views
 
 import (
+	"html"
 	"io"
+	"strings"
 
 	"github.com/a-h/templ"
 	"github.com/labstack/echo/v4"
@@ -36,3 +38,13 @@ func Unsafe(html string) templ.Component {
 	}
 	return templ.ComponentFunc(cf)
 }
+
+// Highlight escapes text and wraps fragments enclosed
+// between start and stop markers within <mark> element.
+func Highlight(text, start, stop string) templ.Component {
+	r := strings.NewReplacer(
+		html.EscapeString(start), "<mark>",
+		html.EscapeString(stop), "</mark>",
+	)
+	return Unsafe(r.Replace(html.EscapeString(text)))
+}